@@ -0,0 +1,84 @@
+package api
+
+import (
+	"face-recognition/auth"
+	"face-recognition/model"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+// JWT認証ミドルウェア
+// セッション用の鍵（ローテーション前の鍵を含む）で検証し、トークンをcontextの"user"に、
+// ログインセッションを"session"に設定する
+func (s *Server) RequireLogin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(context echo.Context) error {
+		header := context.Request().Header.Get(echo.HeaderAuthorization)
+		if !strings.HasPrefix(header, "Bearer ") {
+			return echo.NewHTTPError(http.StatusBadRequest, "missing or malformed jwt")
+		}
+		token, err := s.SessionKeys.Parse(strings.TrimPrefix(header, "Bearer "), jwt.MapClaims{})
+		if err != nil || !token.Valid {
+			return &echo.HTTPError{
+				Code:     http.StatusUnauthorized,
+				Message:  "invalid or expired jwt",
+				Internal: err,
+			}
+		}
+		// ログアウト・失効済みのセッションのトークンは拒否する
+		claims := token.Claims.(jwt.MapClaims)
+		sessionId, _ := claims["sid"].(string)
+		userId, _ := claims["userId"].(float64)
+		session := model.UserSession{}
+		if sessionId != "" {
+			s.DB.Where("session_id = ?", sessionId).Find(&session)
+		}
+		if session.Id == 0 || session.MstUserId != userId || !session.Active(s.Clock()) {
+			return &echo.HTTPError{
+				Code:    http.StatusUnauthorized,
+				Message: "invalid or expired jwt",
+			}
+		}
+		context.Set("user", token)
+		context.Set("session", session)
+		return next(context)
+	}
+}
+
+// 権限チェックミドルウェア（RequireLoginの後に設定する）
+// ロールはトークンではなくユーザマスタから取得し、変更を即時に反映する
+// ログインユーザをcontextの"loginUser"に設定する
+func (s *Server) RequirePermission(permission auth.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			session := currentSession(context)
+			user := model.MstUser{}
+			s.DB.Where("id = ?", session.MstUserId).Find(&user)
+			if user.Id == 0 {
+				return echo.ErrUnauthorized
+			}
+			// 利用停止中のユーザは発行済みのトークンでも操作できない
+			if !user.Active() {
+				s.Logger.Info("利用停止中のユーザです", zap.Float64("userId", user.Id))
+				return echo.ErrForbidden
+			}
+			if !auth.Role(user.Role).Can(permission) {
+				s.Logger.Info("権限がありません",
+					zap.Float64("userId", user.Id),
+					zap.String("role", user.Role),
+					zap.String("permission", string(permission)),
+				)
+				return echo.ErrForbidden
+			}
+			context.Set("loginUser", user)
+			return next(context)
+		}
+	}
+}
+
+// 権限チェックミドルウェアが設定したログインユーザ
+func currentUser(context echo.Context) model.MstUser {
+	return context.Get("loginUser").(model.MstUser)
+}
@@ -0,0 +1,307 @@
+package api
+
+import (
+	"face-recognition/matcher"
+	"face-recognition/model"
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+	"strconv"
+)
+
+// ユーザごとに顔認証に利用できる顔写真の上限
+const maxActiveEnrollments = 5
+
+// 自身の顔写真の再登録
+func (s *Server) PutMyPhoto(context echo.Context) error {
+	return s.registerPhoto(context, currentUser(context), true)
+}
+
+// ユーザの顔写真の再登録（管理者のみ）
+func (s *Server) PutUserPhoto(context echo.Context) error {
+	user := model.MstUser{}
+	s.DB.Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		return userNotFound(context)
+	}
+	return s.registerPhoto(context, user, true)
+}
+
+// 自身の顔写真の追加
+func (s *Server) PostMyEnrollment(context echo.Context) error {
+	return s.registerPhoto(context, currentUser(context), false)
+}
+
+// ユーザの顔写真の追加（管理者のみ）
+func (s *Server) PostUserEnrollment(context echo.Context) error {
+	user := model.MstUser{}
+	s.DB.Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		return userNotFound(context)
+	}
+	return s.registerPhoto(context, user, false)
+}
+
+// 自身の顔写真の利用終了
+func (s *Server) DeleteMyEnrollment(context echo.Context) error {
+	return s.deactivateEnrollment(context, currentUser(context))
+}
+
+// ユーザの顔写真の利用終了（管理者のみ）
+func (s *Server) DeleteUserEnrollment(context echo.Context) error {
+	user := model.MstUser{}
+	s.DB.Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		return userNotFound(context)
+	}
+	return s.deactivateEnrollment(context, user)
+}
+
+// 自身の顔写真の登録履歴
+func (s *Server) GetMyEnrollments(context echo.Context) error {
+	return s.enrollmentsResponse(context, currentUser(context).Id)
+}
+
+// ユーザの顔写真の登録履歴（管理者のみ）
+func (s *Server) GetUserEnrollments(context echo.Context) error {
+	user := model.MstUser{}
+	s.DB.Unscoped().Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		return userNotFound(context)
+	}
+	return s.enrollmentsResponse(context, user.Id)
+}
+
+// 顔写真を登録する
+// replaceの場合は利用中の写真をすべて利用終了にして置き換え、そうでなければ利用中の写真に追加する（以前の写真は履歴として残る）
+func (s *Server) registerPhoto(context echo.Context, user model.MstUser, replace bool) error {
+	s.Logger.Info("顔写真登録API開始", zap.Float64("userId", user.Id), zap.Bool("replace", replace))
+	params := new(model.PhotoParams)
+	if err := context.Bind(params); err != nil {
+		s.Logger.Info("顔写真登録パラメータバインド失敗")
+		s.Logger.Info("顔写真登録API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New()
+	if err := validate.Struct(params); err != nil {
+		var errorMessages []string
+		for _, err := range err.(validator.ValidationErrors) {
+			var errMsg string
+			switch err.Field() {
+			case "Photo":
+				errMsg = "写真は必須項目です"
+				if err.Tag() == "base64" {
+					errMsg = "写真のフォーマットが不正です"
+				}
+			case "Label":
+				errMsg = "ラベルは32文字以内で入力してください"
+			}
+			errorMessages = append(errorMessages, errMsg)
+		}
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("顔写真登録API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	if !replace && len(s.activeEnrollments(user.Id)) >= maxActiveEnrollments {
+		s.Logger.Info("顔写真の登録数が上限に達しています", zap.Float64("userId", user.Id))
+		s.Logger.Info("顔写真登録API終了")
+		return context.JSON(http.StatusBadRequest, []string{"顔写真は5枚まで登録できます"})
+	}
+	reasons, err := s.checkEnrollmentPhoto(params.Photo)
+	if err != nil {
+		s.Logger.Info("顔写真の品質確認失敗", zap.String("error", err.Error()))
+		s.Logger.Info("顔写真登録API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "顔写真を確認できませんでした",
+		})
+	}
+	if len(reasons) > 0 {
+		s.Logger.Info("顔写真が登録に適していません", zap.Strings("理由", qualityReasonCodes(reasons)))
+		s.Logger.Info("顔写真登録API終了")
+		return poorPhotoResponse(context, reasons)
+	}
+	fileId := xid.New().String()
+	imageUrl, photo, err := s.putPhoto(fileId, params.Photo)
+	if err != nil {
+		s.Logger.Info("アップロードエラー発生")
+		s.Logger.Info("顔写真登録API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "画像を登録できませんでした",
+		})
+	}
+	tx := s.DB.Begin()
+	// コミットせずに終了した場合はロールバック（共有のコネクションプールは閉じない）
+	defer tx.RollbackUnlessCommitted()
+	var faceIds []string
+	if replace {
+		faceIds, err = s.deactivateEnrollments(tx.Where("mst_user_id = ?", user.Id))
+	}
+	enrollment := model.FaceEnrollment{}
+	if err == nil {
+		enrollment, err = s.enroll(tx, user, fileId, imageUrl, params.Label)
+	}
+	if err != nil {
+		s.Logger.Info("顔写真登録失敗", zap.String("error", err.Error()))
+		// 登録できなかった画像は残さない
+		if err := s.Store.Delete(fileId); err != nil {
+			s.Logger.Info("画像削除失敗", zap.String("fileId", fileId))
+		}
+		s.Logger.Info("顔写真登録API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "顔写真を登録できませんでした",
+		})
+	}
+	tx.Commit()
+	// 顔検索の索引はDBのコミット後に更新する（失敗してもindex-facesサブコマンドで揃え直す）
+	s.removeFaces(faceIds)
+	s.indexEnrolled(&enrollment, matcher.Image{Key: fileId, Bytes: photo})
+	s.Logger.Info("顔写真登録API終了", zap.Float64("userId", user.Id), zap.Int("version", enrollment.Version))
+	return context.JSON(http.StatusOK, s.withEnrollmentPhoto(enrollment))
+}
+
+// 顔写真を利用終了にする（画像と履歴は残す）
+// 顔認証できなくなるため、利用中の最後の1枚は利用終了にできない
+func (s *Server) deactivateEnrollment(context echo.Context, user model.MstUser) error {
+	s.Logger.Info("顔写真利用終了API開始", zap.Float64("userId", user.Id))
+	enrollment := model.FaceEnrollment{}
+	s.DB.Where("id = ? AND mst_user_id = ? AND active = ?", context.Param("enrollmentId"), user.Id, true).Find(&enrollment)
+	if enrollment.Id == 0 {
+		s.Logger.Info("顔写真利用終了API終了")
+		return context.JSON(http.StatusNotFound, map[string]interface{}{
+			"message": "顔写真が見つかりません",
+		})
+	}
+	remaining := []model.FaceEnrollment{}
+	for _, e := range s.activeEnrollments(user.Id) {
+		if e.Id != enrollment.Id {
+			remaining = append(remaining, e)
+		}
+	}
+	if len(remaining) == 0 {
+		s.Logger.Info("利用中の最後の顔写真です", zap.Float64("enrollmentId", enrollment.Id))
+		s.Logger.Info("顔写真利用終了API終了")
+		return context.JSON(http.StatusBadRequest, []string{"利用中の最後の顔写真は削除できません"})
+	}
+	tx := s.DB.Begin()
+	// コミットせずに終了した場合はロールバック（共有のコネクションプールは閉じない）
+	defer tx.RollbackUnlessCommitted()
+	faceIds, err := s.deactivateEnrollments(tx.Where("id = ?", enrollment.Id))
+	// ユーザマスタの写真は利用中の最新の写真にする
+	if err == nil && user.S3Key == enrollment.S3Key {
+		err = tx.Model(&user).Updates(map[string]interface{}{"photo": remaining[0].Photo, "s3_key": remaining[0].S3Key}).Error
+	}
+	if err != nil {
+		s.Logger.Info("顔写真利用終了失敗", zap.String("error", err.Error()))
+		s.Logger.Info("顔写真利用終了API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "顔写真を削除できませんでした",
+		})
+	}
+	tx.Commit()
+	s.removeFaces(faceIds)
+	s.Logger.Info("顔写真利用終了API終了", zap.Float64("enrollmentId", enrollment.Id))
+	return context.NoContent(http.StatusNoContent)
+}
+
+// 顔写真の登録履歴を追加して利用中にし、ユーザマスタの写真も新しいものに置き換える
+// 1:N検索の索引への登録は外部APIを呼び出すため、コミット後にindexEnrolledで行う
+func (s *Server) enroll(tx *gorm.DB, user model.MstUser, key string, url string, label string) (model.FaceEnrollment, error) {
+	var version int
+	row := tx.Model(&model.FaceEnrollment{}).Where("mst_user_id = ?", user.Id).Select("COALESCE(MAX(version), 0)").Row()
+	if err := row.Scan(&version); err != nil {
+		return model.FaceEnrollment{}, err
+	}
+	enrollment := model.FaceEnrollment{
+		MstUserId: user.Id,
+		Version:   version + 1,
+		Label:     label,
+		Photo:     url,
+		S3Key:     key,
+		Active:    true,
+	}
+	// 同じ版数の同時登録は一意制約でエラーになる
+	if err := tx.Create(&enrollment).Error; err != nil {
+		return model.FaceEnrollment{}, err
+	}
+	err := tx.Model(&user).Updates(map[string]interface{}{"photo": url, "s3_key": key}).Error
+	return enrollment, err
+}
+
+// コミットした顔写真を顔検索の索引に登録する
+// 登録できなくても顔写真は1:1の顔認証に使えるため、エラーにはせずindex-facesサブコマンドで登録し直す
+func (s *Server) indexEnrolled(enrollment *model.FaceEnrollment, image matcher.Image) {
+	if err := s.indexEnrollment(s.DB, enrollment, image); err != nil {
+		s.Logger.Info("顔検索の索引への登録失敗", zap.Float64("enrollmentId", enrollment.Id), zap.String("error", err.Error()))
+	}
+}
+
+// 顔写真を顔検索の索引に登録する（外部IDは登録履歴のId）
+// 顔が検出されなかった場合は索引に登録せず、1:N検索の対象にならない
+func (s *Server) indexEnrollment(db *gorm.DB, enrollment *model.FaceEnrollment, image matcher.Image) error {
+	faceId, err := s.Matcher.IndexFace(strconv.FormatFloat(enrollment.Id, 'f', -1, 64), image)
+	if err != nil {
+		return err
+	}
+	if faceId == "" {
+		s.Logger.Info("索引に登録する顔が検出されませんでした", zap.Float64("enrollmentId", enrollment.Id))
+		return nil
+	}
+	if err := db.Model(enrollment).Update("face_id", faceId).Error; err != nil {
+		// 登録履歴から参照できない顔は索引に残さない
+		if err := s.Matcher.DeleteFaces([]string{faceId}); err != nil {
+			s.Logger.Info("顔検索の索引からの削除失敗", zap.String("faceId", faceId), zap.String("error", err.Error()))
+		}
+		return err
+	}
+	enrollment.FaceId = faceId
+	return nil
+}
+
+// 条件に一致する利用中の顔写真を利用終了にし、顔検索の索引から削除する顔IDを返す
+// 索引からの削除は外部APIを呼び出すため、コミット後にremoveFacesで行う
+func (s *Server) deactivateEnrollments(scope *gorm.DB) ([]string, error) {
+	scope = scope.Model(&model.FaceEnrollment{}).Where("active = ?", true)
+	var faceIds []string
+	if err := scope.Where("face_id <> ''").Pluck("face_id", &faceIds).Error; err != nil {
+		return nil, err
+	}
+	err := scope.Updates(map[string]interface{}{"active": false, "deactivated_at": s.Clock()}).Error
+	return faceIds, err
+}
+
+// 利用終了にした顔写真を顔検索の索引から削除し、登録履歴の顔IDを空にする
+// 削除できなかった顔は顔IDを残し、index-facesサブコマンドで削除し直す
+func (s *Server) removeFaces(faceIds []string) {
+	if err := s.deleteFaces(faceIds); err != nil {
+		s.Logger.Info("顔検索の索引からの削除失敗", zap.Strings("faceIds", faceIds), zap.String("error", err.Error()))
+	}
+}
+
+func (s *Server) deleteFaces(faceIds []string) error {
+	if len(faceIds) == 0 {
+		return nil
+	}
+	if err := s.Matcher.DeleteFaces(faceIds); err != nil {
+		return err
+	}
+	return s.DB.Model(&model.FaceEnrollment{}).Where("active = ? AND face_id IN (?)", false, faceIds).Update("face_id", "").Error
+}
+
+// 顔認証に利用中の顔写真（新しい順）
+func (s *Server) activeEnrollments(userId float64) []model.FaceEnrollment {
+	enrollments := []model.FaceEnrollment{}
+	s.DB.Where("mst_user_id = ? AND active = ?", userId, true).Order("version DESC").Find(&enrollments)
+	return enrollments
+}
+
+func (s *Server) enrollmentsResponse(context echo.Context, userId float64) error {
+	enrollments := []model.FaceEnrollment{}
+	s.DB.Where("mst_user_id = ?", userId).Order("version DESC").Find(&enrollments)
+	for i := range enrollments {
+		enrollments[i] = s.withEnrollmentPhoto(enrollments[i])
+	}
+	return context.JSON(http.StatusOK, enrollments)
+}
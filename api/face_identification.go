@@ -0,0 +1,192 @@
+package api
+
+import (
+	"face-recognition/matcher"
+	"face-recognition/model"
+	"face-recognition/policy"
+	"github.com/labstack/echo"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+	"strconv"
+)
+
+// 1:N検索で取得する候補の数（利用終了・利用停止の顔を除いた最上位の候補を判定する）
+const identificationCandidates = 10
+
+// 顔識別（QRトークンなしで、登録済みのすべての顔写真から本人を特定する）
+func (s *Server) PostFaceIdentification(context echo.Context) error {
+	s.Logger.Info("顔識別API開始")
+	params := new(model.FaceIdentificationParams)
+	if err := context.Bind(params); err != nil {
+		s.Logger.Info("顔識別パラメータバインド失敗")
+		s.Logger.Info("顔識別API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New()
+	if err := validate.Struct(params); err != nil {
+		var errorMessages []string
+		for _, err := range err.(validator.ValidationErrors) {
+			var errMsg string
+			switch err.Field() {
+			case "Photo":
+				errMsg = "写真は必須項目です"
+				if err.Tag() == "base64" {
+					errMsg = "写真のフォーマットが不正です"
+				}
+			case "Location":
+				errMsg = "設置場所は64文字以内で指定してください"
+			}
+			errorMessages = append(errorMessages, errMsg)
+		}
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("顔識別API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	location, ok := kioskLocation(context, params.Location)
+	if !ok {
+		s.Logger.Info("パラメータエラー", zap.String("location", params.Location))
+		s.Logger.Info("顔識別API終了")
+		return context.JSON(http.StatusBadRequest, []string{"設置場所が端末の設定と一致しません"})
+	}
+	// 比較対象画像を画像ストレージへアップロード
+	fileId := xid.New().String()
+	imageUrl, photo, err := s.putPhoto(fileId, params.Photo)
+	if err != nil {
+		s.Logger.Info("比較先画像のアップロードエラー発生")
+		s.Logger.Info("顔識別API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "比較先画像をアップロードできませんでした",
+		})
+	}
+	// 撮影した写真の顔を確認し、検索できない場合はその理由を返す
+	// 利用者を特定できないため、顔認証結果には記録せず画像も残さない
+	probe := matcher.Image{Key: fileId, Bytes: photo}
+	if outcome := s.checkProbe(probe); outcome != "" {
+		return s.unidentified(context, fileId, outcome)
+	}
+	spoofScore, outcome := s.checkSpoof(photo)
+	if outcome != "" {
+		return s.unidentified(context, fileId, outcome)
+	}
+	matches, err := s.Matcher.SearchFaces(probe, identificationCandidates)
+	if err != nil {
+		s.Logger.Info("顔検索失敗", zap.String("error", err.Error()))
+		return s.unidentified(context, fileId, model.OutcomeBackendError)
+	}
+	enrollment, user, similarity, ok := s.identify(matches)
+	if !ok {
+		s.Logger.Info("候補のユーザがいません", zap.Int("候補数", len(matches)))
+		return s.unidentified(context, fileId, model.OutcomeNotMatched)
+	}
+	result := model.FaceRecognitionResult{
+		MstUserId:        user.Id,
+		FaceEnrollmentId: &enrollment.Id,
+		Method:           model.RecognitionMethodIdentification,
+		SourceImage:      enrollment.Photo,
+		SourceImageS3Key: enrollment.S3Key,
+		TargetImage:      imageUrl,
+		TargetImageS3Key: fileId,
+		Result:           similarity,
+		SpoofScore:       spoofScore,
+	}
+	// 候補のユーザに適用するしきい値で判定する
+	decision := s.settleOutcome(&result, user, location, "")
+	if decision == policy.DecisionReject {
+		s.Logger.Info("候補のユーザと一致しません", zap.Float64("userId", user.Id), zap.Float64("類似度", similarity))
+		return s.unidentified(context, fileId, result.Outcome)
+	}
+	tx := s.DB.Begin()
+	// コミットせずに終了した場合はロールバック（共有のコネクションプールは閉じない）
+	defer tx.RollbackUnlessCommitted()
+	if err := tx.Create(&result).Error; err != nil {
+		s.Logger.Info("顔認証結果登録失敗")
+		s.Logger.Info("顔識別API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "顔認証結果テーブルへ登録できませんでした",
+		})
+	}
+	tx.Commit()
+	identified := decision == policy.DecisionAccept
+	s.Logger.Info("顔識別API終了", zap.Bool("結果", identified), zap.Float64("userId", user.Id), zap.Float64("類似度", similarity))
+	// 要確認の場合は本人と特定せず、運用担当者が確認できるよう候補を返す
+	return context.JSON(http.StatusOK, map[string]interface{}{
+		"identified":       identified,
+		"decision":         decision,
+		"outcome":          result.Outcome,
+		"userId":           user.Id,
+		"username":         user.Username,
+		"similarity":       similarity,
+		"faceEnrollmentId": enrollment.Id,
+	})
+}
+
+// 本人を特定できなかった場合のレスポンス（撮影した画像は削除する）
+func (s *Server) unidentified(context echo.Context, fileId string, outcome string) error {
+	if err := s.Store.Delete(fileId); err != nil {
+		s.Logger.Info("画像削除失敗", zap.String("fileId", fileId))
+	}
+	s.Logger.Info("顔識別API終了", zap.Bool("結果", false), zap.String("種類", outcome))
+	if outcome == model.OutcomeBackendError {
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "顔認証に失敗しました",
+			"outcome": outcome,
+		})
+	}
+	return context.JSON(http.StatusOK, map[string]interface{}{
+		"identified": false,
+		"decision":   policy.DecisionReject,
+		"outcome":    outcome,
+	})
+}
+
+// 検索結果から、利用中の顔写真を持つ利用可能なユーザのうち最も類似度の高い候補を選ぶ
+// 索引には利用終了・削除の反映前の顔が残っている場合があるため、DBの状態で絞り込む
+func (s *Server) identify(matches []matcher.FaceMatch) (model.FaceEnrollment, model.MstUser, float64, bool) {
+	for _, match := range matches {
+		enrollment := model.FaceEnrollment{}
+		s.DB.Where("face_id = ? AND active = ?", match.FaceId, true).Find(&enrollment)
+		if enrollment.Id == 0 || strconv.FormatFloat(enrollment.Id, 'f', -1, 64) != match.ExternalId {
+			continue
+		}
+		user := model.MstUser{}
+		s.DB.Where("id = ?", enrollment.MstUserId).Find(&user)
+		if user.Id == 0 || !user.Active() {
+			continue
+		}
+		return enrollment, user, match.Similarity, true
+	}
+	return model.FaceEnrollment{}, model.MstUser{}, 0, false
+}
+
+// 顔検索の索引を顔写真の登録履歴に揃える（index-facesサブコマンド）
+// 利用終了後に索引から削除できなかった顔を削除し、索引に未登録の利用中の顔写真を登録して、登録した件数を返す
+// 1:N検索の導入前に登録された顔写真の移行や、顔写真の登録・利用終了時に索引を更新できなかった場合に利用する
+func (s *Server) IndexPendingEnrollments() (int, error) {
+	var faceIds []string
+	if err := s.DB.Model(&model.FaceEnrollment{}).Where("active = ? AND face_id <> ''", false).Pluck("face_id", &faceIds).Error; err != nil {
+		return 0, err
+	}
+	if err := s.deleteFaces(faceIds); err != nil {
+		return 0, err
+	}
+	enrollments := []model.FaceEnrollment{}
+	if err := s.DB.Where("active = ? AND face_id = ''", true).Order("id").Find(&enrollments).Error; err != nil {
+		return 0, err
+	}
+	indexed := 0
+	for _, enrollment := range enrollments {
+		photo, err := s.Store.Get(enrollment.S3Key)
+		if err != nil {
+			return indexed, err
+		}
+		if err := s.indexEnrollment(s.DB, &enrollment, matcher.Image{Key: enrollment.S3Key, Bytes: photo}); err != nil {
+			return indexed, err
+		}
+		if enrollment.FaceId != "" {
+			indexed++
+		}
+	}
+	return indexed, nil
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"face-recognition/matcher"
+	"face-recognition/model"
+	"face-recognition/policy"
+	"go.uber.org/zap"
+)
+
+// 撮影した写真の顔を比較に使える最低限の品質
+const (
+	// 顔である確からしさ（0-100）
+	minProbeFaceConfidence = 90.0
+	// 画像に対する顔の幅・高さの比率
+	minProbeFaceSize = 0.05
+)
+
+// 撮影した写真の顔を検出し、比較できない場合は結果の種類を返す（比較できる場合は空）
+func (s *Server) checkProbe(probe matcher.Image) string {
+	faces, err := s.Matcher.DetectFaces(probe)
+	if err != nil {
+		s.Logger.Info("顔検出失敗", zap.String("error", err.Error()))
+		return model.OutcomeBackendError
+	}
+	switch {
+	case len(faces) == 0:
+		return model.OutcomeNoFaceDetected
+	case len(faces) > 1:
+		return model.OutcomeMultipleFaces
+	}
+	face := faces[0]
+	if face.Confidence < minProbeFaceConfidence || face.BoundingBox.Width < minProbeFaceSize || face.BoundingBox.Height < minProbeFaceSize {
+		s.Logger.Info("顔の品質が不足しています", zap.Float64("confidence", face.Confidence), zap.Float64("width", face.BoundingBox.Width), zap.Float64("height", face.BoundingBox.Height))
+		return model.OutcomeLowQuality
+	}
+	return ""
+}
+
+// 撮影した写真のなりすましスコアを求め、しきい値を超えた場合は結果の種類を返す（超えない場合は空）
+// なりすまし検知エンジンがない場合のスコアはnil
+func (s *Server) checkSpoof(photo []byte) (*float64, string) {
+	if s.Spoof == nil {
+		return nil, ""
+	}
+	score, err := s.Spoof.Score(photo)
+	if err != nil {
+		s.Logger.Info("なりすまし検知失敗", zap.String("error", err.Error()))
+		return nil, model.OutcomeBackendError
+	}
+	if score > s.SpoofThreshold {
+		s.Logger.Info("なりすましの疑いがあります", zap.Float64("score", score), zap.Float64("threshold", s.SpoofThreshold))
+		return &score, model.OutcomeSpoofSuspected
+	}
+	return &score, ""
+}
+
+// 顔照合エンジンのエラーを結果の種類にする
+func compareOutcome(err error) string {
+	if err == matcher.ErrNoFace {
+		return model.OutcomeNoFaceDetected
+	}
+	return model.OutcomeBackendError
+}
+
+// 判定から結果の種類を決めて顔認証結果に設定する
+// 比較できなかった場合（outcomeが空でない）はしきい値によらず類似度0の本人ではないとして記録する
+func (s *Server) settleOutcome(result *model.FaceRecognitionResult, user model.MstUser, location string, outcome string) policy.Decision {
+	if outcome != "" {
+		result.Result = 0
+		s.applyThresholds(result, user, location)
+		result.Decision = string(policy.DecisionReject)
+		result.Outcome = outcome
+		return policy.DecisionReject
+	}
+	decision := s.decide(result, user, location)
+	result.Outcome = model.OutcomeNotMatched
+	if decision == policy.DecisionAccept {
+		result.Outcome = model.OutcomeMatched
+	}
+	return decision
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/base64"
+	"face-recognition/matcher"
+	"face-recognition/model"
+	"github.com/labstack/echo"
+	"math"
+	"net/http"
+)
+
+// 登録する顔写真に求める品質（顔認証時の写真より厳しくする）
+const (
+	// 画像に対する顔の幅・高さの比率
+	minEnrollFaceSize = 0.1
+	// 鮮明さ（0-100）
+	minEnrollSharpness = 20.0
+	// 目を閉じていると判定する確からしさ（0-100）
+	minEyesClosedConfidence = 80.0
+	// 正面からの顔の向きの許容範囲（度）
+	maxEnrollPoseAngle = 30.0
+)
+
+// 登録する顔写真の顔を検出し、登録できない理由を返す（登録できる場合は空）
+// 写真はアップロード前に確認し、登録できない写真はストレージにもDBにも残さない
+func (s *Server) checkEnrollmentPhoto(photoBase64 string) ([]model.QualityReason, error) {
+	data, err := base64.StdEncoding.DecodeString(photoBase64)
+	if err != nil {
+		return nil, err
+	}
+	faces, err := s.Matcher.DetectFaces(matcher.Image{Bytes: data})
+	if err != nil {
+		return nil, err
+	}
+	return enrollmentQualityReasons(faces), nil
+}
+
+// 顔が1つだけ写っていて、小さすぎ・不鮮明・目を閉じている・正面を向いていない、のいずれでもないこと
+func enrollmentQualityReasons(faces []matcher.FaceDetail) []model.QualityReason {
+	switch {
+	case len(faces) == 0:
+		return []model.QualityReason{{Code: model.QualityNoFaceDetected, Message: "顔が写っていません"}}
+	case len(faces) > 1:
+		return []model.QualityReason{{Code: model.QualityMultipleFaces, Message: "複数の顔が写っています"}}
+	}
+	face := faces[0]
+	var reasons []model.QualityReason
+	if face.BoundingBox.Width < minEnrollFaceSize || face.BoundingBox.Height < minEnrollFaceSize {
+		reasons = append(reasons, model.QualityReason{Code: model.QualityFaceTooSmall, Message: "顔が小さすぎます"})
+	}
+	if face.Sharpness < minEnrollSharpness {
+		reasons = append(reasons, model.QualityReason{Code: model.QualityTooBlurry, Message: "写真が不鮮明です"})
+	}
+	if !face.EyesOpen && face.EyesOpenConfidence >= minEyesClosedConfidence {
+		reasons = append(reasons, model.QualityReason{Code: model.QualityEyesClosed, Message: "目を閉じています"})
+	}
+	if math.Abs(face.Pose.Yaw) > maxEnrollPoseAngle || math.Abs(face.Pose.Pitch) > maxEnrollPoseAngle || math.Abs(face.Pose.Roll) > maxEnrollPoseAngle {
+		reasons = append(reasons, model.QualityReason{Code: model.QualityExtremePose, Message: "顔が正面を向いていません"})
+	}
+	return reasons
+}
+
+// 顔写真を登録できない場合のレスポンス
+func poorPhotoResponse(context echo.Context, reasons []model.QualityReason) error {
+	return context.JSON(http.StatusBadRequest, map[string]interface{}{
+		"message": "顔写真が登録に適していません",
+		"reasons": reasons,
+	})
+}
+
+func qualityReasonCodes(reasons []model.QualityReason) []string {
+	codes := make([]string, 0, len(reasons))
+	for _, r := range reasons {
+		codes = append(codes, r.Code)
+	}
+	return codes
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/base64"
+	"face-recognition/model"
+	"face-recognition/storage"
+	"github.com/labstack/echo"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// レスポンスで返すローカルファイルシステムの画像URLの有効期限
+const imageURLExpires = time.Hour
+
+// ローカルファイルシステムに保存した画像の取得（署名付きURLのみ許可）
+func (s *Server) GetImage(context echo.Context) error {
+	store, ok := s.Store.(*storage.LocalStore)
+	if !ok {
+		return echo.ErrNotFound
+	}
+	key := context.Param("key")
+	if !store.Verify(key, context.QueryParam("expires"), context.QueryParam("signature")) {
+		return echo.ErrForbidden
+	}
+	data, err := store.Get(key)
+	if err == storage.ErrNotFound {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		s.Logger.Info("画像取得エラー", zap.String("key", key), zap.String("error", err.Error()))
+		return echo.ErrInternalServerError
+	}
+	return context.Blob(http.StatusOK, http.DetectContentType(data), data)
+}
+
+// base64形式の写真をデコードして画像ストレージへ保存
+func (s *Server) putPhoto(key string, photoBase64 string) (url string, data []byte, err error) {
+	data, err = base64.StdEncoding.DecodeString(photoBase64)
+	if err != nil {
+		s.Logger.Info("base64から画像生成エラー", zap.String("ファイル", key))
+		return "", nil, err
+	}
+	contentType, err := storage.ContentType("png")
+	if err != nil {
+		return "", nil, err
+	}
+	url, err = s.Store.Put(key, data, contentType)
+	if err != nil {
+		s.Logger.Info("画像アップロードエラー", zap.String("ファイル", key), zap.String("error", err.Error()))
+		return "", nil, err
+	}
+	return url, data, nil
+}
+
+// レスポンスで返す画像のURL
+// ローカルファイルシステムの画像は署名付きURLでしか参照できないため、保存したURLの代わりに署名付きURLを返す
+func (s *Server) imageURL(key string, url string) string {
+	store, ok := s.Store.(*storage.LocalStore)
+	if !ok || key == "" {
+		return url
+	}
+	signed, err := store.SignedURL(key, imageURLExpires)
+	if err != nil {
+		s.Logger.Info("署名付きURL生成エラー", zap.String("key", key), zap.String("error", err.Error()))
+		return url
+	}
+	return signed
+}
+
+// ユーザの顔写真を参照できるURLにする
+func (s *Server) withUserPhoto(user model.MstUser) model.MstUser {
+	user.Photo = s.imageURL(user.S3Key, user.Photo)
+	return user
+}
+
+// 顔写真の登録履歴の写真を参照できるURLにする
+func (s *Server) withEnrollmentPhoto(enrollment model.FaceEnrollment) model.FaceEnrollment {
+	enrollment.Photo = s.imageURL(enrollment.S3Key, enrollment.Photo)
+	return enrollment
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"crypto/rand"
+	"face-recognition/matcher"
+	"face-recognition/model"
+	"github.com/labstack/echo"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// ライブネスチャレンジの判定基準
+const (
+	// 1回のチャレンジで求める動作の数
+	livenessChallengeSteps = 2
+	// 首を左右に振ったとみなす顔の向き（度）
+	livenessTurnAngle = 20.0
+	// 上下を向いたとみなす顔の向き（度）
+	livenessNodAngle = 15.0
+	// 撮影した写真と同じ人物のフレームとみなす類似度
+	minLivenessFrameSimilarity = 80.0
+)
+
+// ライブネスチャレンジ発行
+// 端末はチャレンジの動作を案内し、撮影した連続フレームをチャレンジIDとともに顔認証APIへ送る
+func (s *Server) PostLivenessChallenge(context echo.Context) error {
+	s.Logger.Info("ライブネスチャレンジ発行API開始")
+	steps, err := livenessChallengeStepList()
+	if err != nil {
+		s.Logger.Info("チャレンジの動作を選べませんでした", zap.String("error", err.Error()))
+		s.Logger.Info("ライブネスチャレンジ発行API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ライブネスチャレンジを発行できませんでした",
+		})
+	}
+	challenge := model.LivenessChallenge{
+		ChallengeId: xid.New().String(),
+		MstUserId:   currentUser(context).Id,
+		Steps:       strings.Join(steps, ","),
+		ExpiresAt:   s.Clock().Add(s.LivenessChallengeTTL),
+	}
+	if err := s.DB.Create(&challenge).Error; err != nil {
+		s.Logger.Info("ライブネスチャレンジ登録失敗", zap.String("error", err.Error()))
+		s.Logger.Info("ライブネスチャレンジ発行API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ライブネスチャレンジを発行できませんでした",
+		})
+	}
+	s.Logger.Info("ライブネスチャレンジ発行API終了", zap.String("challengeId", challenge.ChallengeId), zap.Strings("steps", steps))
+	return context.JSON(http.StatusOK, map[string]interface{}{
+		"challengeId": challenge.ChallengeId,
+		"steps":       steps,
+		"expiresAt":   challenge.ExpiresAt,
+	})
+}
+
+// 求める動作を重複なくランダムに選ぶ（端末側で予測できないよう暗号論的乱数を使う）
+func livenessChallengeStepList() ([]string, error) {
+	candidates := append([]string(nil), model.LivenessSteps...)
+	steps := make([]string, 0, livenessChallengeSteps)
+	for len(steps) < livenessChallengeSteps {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(candidates))))
+		if err != nil {
+			return nil, err
+		}
+		i := n.Int64()
+		steps = append(steps, candidates[i])
+		candidates = append(candidates[:i], candidates[i+1:]...)
+	}
+	return steps, nil
+}
+
+// 端末に発行した有効なチャレンジを利用済みにする
+// 同じチャレンジで同時に顔認証された場合は、先に利用した方のみ成功させる
+func (s *Server) useLivenessChallenge(challengeId string, kioskId float64) (model.LivenessChallenge, bool) {
+	challenge := model.LivenessChallenge{}
+	s.DB.Where("challenge_id = ? AND mst_user_id = ?", challengeId, kioskId).Find(&challenge)
+	now := s.Clock()
+	if challenge.Id == 0 || challenge.UsedAt != nil || !now.Before(challenge.ExpiresAt) {
+		return challenge, false
+	}
+	result := s.DB.Model(&model.LivenessChallenge{}).
+		Where("id = ? AND used_at IS NULL", challenge.Id).
+		Update("used_at", now)
+	return challenge, result.Error == nil && result.RowsAffected == 1
+}
+
+// 連続フレームでチャレンジの動作を順番どおりに行ったかを確認し、確認できない場合は結果の種類を返す（確認できた場合は空）
+// すべてのフレームに撮影した写真と同じ人物の顔が1つだけ写っている必要がある
+func (s *Server) checkLiveness(probe matcher.Image, steps []string, frames [][]byte) string {
+	next := 0
+	for i, frame := range frames {
+		image := matcher.Image{Bytes: frame}
+		faces, err := s.Matcher.DetectFaces(image)
+		if err != nil {
+			s.Logger.Info("フレームの顔検出失敗", zap.String("error", err.Error()), zap.Int("frame", i))
+			return model.OutcomeBackendError
+		}
+		if len(faces) != 1 {
+			s.Logger.Info("フレームに顔が1つだけ写っていません", zap.Int("frame", i), zap.Int("faces", len(faces)))
+			return model.OutcomeLivenessFailed
+		}
+		similarity, err := s.Matcher.CompareFaces(probe, image)
+		if err != nil {
+			s.Logger.Info("フレームの顔照合失敗", zap.String("error", err.Error()), zap.Int("frame", i))
+			if err == matcher.ErrNoFace {
+				return model.OutcomeLivenessFailed
+			}
+			return model.OutcomeBackendError
+		}
+		if similarity < minLivenessFrameSimilarity {
+			s.Logger.Info("撮影した写真と異なる人物のフレームです", zap.Int("frame", i), zap.Float64("類似度", similarity))
+			return model.OutcomeLivenessFailed
+		}
+		if next < len(steps) && livenessStepDone(steps[next], faces[0]) {
+			next++
+		}
+	}
+	if next < len(steps) {
+		s.Logger.Info("チャレンジの動作を確認できませんでした", zap.Strings("steps", steps), zap.Int("確認できた動作の数", next))
+		return model.OutcomeLivenessFailed
+	}
+	return ""
+}
+
+// フレームの顔がチャレンジの動作をしているか（Yawは負が向かって左、Pitchは正が上）
+func livenessStepDone(step string, face matcher.FaceDetail) bool {
+	switch step {
+	case model.LivenessStepTurnLeft:
+		return face.Pose.Yaw <= -livenessTurnAngle
+	case model.LivenessStepTurnRight:
+		return face.Pose.Yaw >= livenessTurnAngle
+	case model.LivenessStepLookUp:
+		return face.Pose.Pitch >= livenessNodAngle
+	case model.LivenessStepLookDown:
+		return face.Pose.Pitch <= -livenessNodAngle
+	case model.LivenessStepBlink:
+		return !face.EyesOpen && face.EyesOpenConfidence >= minEyesClosedConfidence
+	}
+	return false
+}
@@ -1,238 +1,398 @@
 package api
 
 import (
-	"face-recognition/aws"
-	"face-recognition/config"
-	"face-recognition/db"
-	"face-recognition/logger"
+	"face-recognition/auth"
+	"face-recognition/matcher"
 	"face-recognition/model"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo"
 	"github.com/rs/xid"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/go-playground/validator.v9"
 	"net/http"
+	"strings"
 	"time"
 )
 
-// ユーザ情報取得
-func GetUser() echo.HandlerFunc {
-	return func(context echo.Context) error {
-		// DB接続
-		db, err := db.SqlConnect()
-		if err != nil {
-			return context.String(http.StatusBadGateway, err.Error())
+// 並び替えに指定できる項目とカラム
+var userSortColumns = map[string]string{
+	"id":        "id",
+	"email":     "email",
+	"username":  "username",
+	"createdAt": "created_at",
+}
+
+// 1ページあたりの件数（指定がない場合）
+const defaultUserPerPage = 20
+
+// ユーザ一覧取得（ページング・絞り込み・並び替え）
+// 全ユーザを参照できるのは管理者のみで、それ以外は自身のみ返却する
+func (s *Server) GetUser(context echo.Context) error {
+	s.Logger.Info("ユーザ一覧取得API開始")
+	params := new(model.UserListParams)
+	if err := context.Bind(params); err != nil {
+		s.Logger.Info("ユーザ一覧取得API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New()
+	var errorMessages []string
+	if err := validate.Struct(params); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			var errMsg string
+			switch err.Field() {
+			case "Page":
+				errMsg = "ページ番号は1以上を指定してください"
+			case "PerPage":
+				errMsg = "1ページあたりの件数は1〜100を指定してください"
+			case "Admin":
+				errMsg = "管理者フラグはtrue、falseのいずれかを指定してください"
+			case "Status":
+				errMsg = "状態はactive、suspendedのいずれかを指定してください"
+			}
+			errorMessages = append(errorMessages, errMsg)
+		}
+	}
+	query := s.DB.Model(&model.MstUser{})
+	if loginUser := currentUser(context); !auth.Role(loginUser.Role).Can(auth.PermissionUserReadAll) {
+		query = query.Where("id = ?", loginUser.Id)
+	}
+	if params.Email != "" {
+		query = query.Where("email LIKE ? ESCAPE '!'", "%"+escapeLike(params.Email)+"%")
+	}
+	if params.Username != "" {
+		query = query.Where("username LIKE ? ESCAPE '!'", "%"+escapeLike(params.Username)+"%")
+	}
+	if params.Admin != "" {
+		query = query.Where("is_admin = ?", params.Admin == "true")
+	}
+	if params.Status != "" {
+		query = query.Where("status = ?", params.Status)
+	}
+	if params.CreatedFrom != "" {
+		if from, err := time.Parse(time.RFC3339, params.CreatedFrom); err != nil {
+			errorMessages = append(errorMessages, "作成日時（開始）の形式が不正です")
 		} else {
-			// ログ出力有効
-			db.LogMode(true)
-			fmt.Println("Successfully connect database..")
+			query = query.Where("created_at >= ?", from)
 		}
-		// DBクローズ（遅延）
-		defer db.Close()
-		// ユーザマスタからレコード取得
-		// 結果を受け取るMstUser型の空のスライスを用意しておき、db.Findの引数でそのアドレスを渡す
-		var users []model.MstUser
-		result := db.Find(&users)
-		return context.JSON(http.StatusOK, result)
 	}
+	if params.CreatedTo != "" {
+		if to, err := time.Parse(time.RFC3339, params.CreatedTo); err != nil {
+			errorMessages = append(errorMessages, "作成日時（終了）の形式が不正です")
+		} else {
+			query = query.Where("created_at < ?", to)
+		}
+	}
+	order, err := userOrder(params.Sort)
+	if err != nil {
+		errorMessages = append(errorMessages, err.Error())
+	}
+	if len(errorMessages) > 0 {
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("ユーザ一覧取得API終了", zap.Any("検索条件", params))
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	page, perPage := params.Page, params.PerPage
+	if page == 0 {
+		page = 1
+	}
+	if perPage == 0 {
+		perPage = defaultUserPerPage
+	}
+	list := model.UserList{Items: []model.MstUser{}, Page: page, PerPage: perPage}
+	if err := query.Count(&list.Total).Error; err != nil {
+		s.Logger.Info("ユーザ件数取得失敗", zap.String("error", err.Error()))
+		s.Logger.Info("ユーザ一覧取得API終了", zap.Any("検索条件", params))
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ユーザを取得できませんでした",
+		})
+	}
+	if err := query.Order(order).Offset((page - 1) * perPage).Limit(perPage).Find(&list.Items).Error; err != nil {
+		s.Logger.Info("ユーザ取得失敗", zap.String("error", err.Error()))
+		s.Logger.Info("ユーザ一覧取得API終了", zap.Any("検索条件", params))
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ユーザを取得できませんでした",
+		})
+	}
+	list.TotalPages = (list.Total + perPage - 1) / perPage
+	for i := range list.Items {
+		list.Items[i] = s.withUserPhoto(list.Items[i])
+	}
+	s.Logger.Info("ユーザ一覧取得API終了", zap.Any("検索条件", params), zap.Int("ページ", page), zap.Int("1ページあたりの件数", perPage), zap.Int("総件数", list.Total))
+	return context.JSON(http.StatusOK, list)
 }
 
-// ログイン認証
-func PostLogin() echo.HandlerFunc {
-	return func(context echo.Context) error {
-		logger.Log.Info("ログイン認証API開始")
-		// DB接続
-		db, err := db.SqlConnect()
-		if err != nil {
-			return context.String(http.StatusBadGateway, err.Error())
-		} else {
-			// ログ出力有効
-			db.LogMode(true)
-			fmt.Println("Successfully connect database..")
+// 並び順の指定をORDER BY句に変換（同じ値の行の順序が変わらないよう、最後にidで並べる）
+func userOrder(sort string) (string, error) {
+	var orders []string
+	hasId := false
+	for _, field := range strings.Split(sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		direction := "ASC"
+		if strings.HasPrefix(field, "-") {
+			direction = "DESC"
+			field = field[1:]
 		}
-		// DBクローズ（遅延）
-		defer db.Close()
-		// リクエストボディーを構造体にバインド
-		u := new(model.LoginParams)
-		if err = context.Bind(u); err != nil {
-			logger.Log.Info("ログイン情報パラメータバインド失敗")
-			logger.Log.Info("ログイン認証API終了")
-			return context.JSON(http.StatusBadRequest, err.Error())
+		column, ok := userSortColumns[field]
+		if !ok {
+			return "", fmt.Errorf("並び替えに指定できない項目です（%s）", field)
 		}
-		// バリデーション
-		validate := validator.New()
-		if err := validate.Struct(u); err != nil {
-			// バリデーションエラーメッセージの加工
-			var errorMessages []string
-			for _, err := range err.(validator.ValidationErrors) {
-				var errMsg string
-				fieldName := err.Field()
-				switch fieldName {
-				case "Email":
-					var tag = err.Tag()
-					switch tag {
-					case "required":
-						errMsg = "メールアドレスは必須項目です"
-					case "email":
-						errMsg = "メールアドレスのフォーマットが不正です"
-					}
-				case "Password":
-					errMsg = "パスワードは必須項目です"
+		hasId = hasId || column == "id"
+		orders = append(orders, column+" "+direction)
+	}
+	if !hasId {
+		orders = append(orders, "id ASC")
+	}
+	return strings.Join(orders, ", "), nil
+}
+
+// LIKE検索の特殊文字をエスケープ
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// ログイン認証
+func (s *Server) PostLogin(context echo.Context) error {
+	s.Logger.Info("ログイン認証API開始")
+	// リクエストボディーを構造体にバインド
+	u := new(model.LoginParams)
+	if err := context.Bind(u); err != nil {
+		s.Logger.Info("ログイン情報パラメータバインド失敗")
+		s.Logger.Info("ログイン認証API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	// バリデーション
+	validate := validator.New()
+	if err := validate.Struct(u); err != nil {
+		// バリデーションエラーメッセージの加工
+		var errorMessages []string
+		for _, err := range err.(validator.ValidationErrors) {
+			var errMsg string
+			fieldName := err.Field()
+			switch fieldName {
+			case "Email":
+				var tag = err.Tag()
+				switch tag {
+				case "required":
+					errMsg = "メールアドレスは必須項目です"
+				case "email":
+					errMsg = "メールアドレスのフォーマットが不正です"
 				}
-				errorMessages = append(errorMessages, errMsg)
+			case "Password":
+				errMsg = "パスワードは必須項目です"
 			}
-			fmt.Println("errMsg：", errorMessages)
-			logger.Log.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
-			logger.Log.Info("ログイン認証API終了")
-			return context.JSON(http.StatusBadRequest, errorMessages)
+			errorMessages = append(errorMessages, errMsg)
 		}
-		// jwt認証
-		var user []model.MstUser
-		db.Where("email = ?", u.Email).Find(&user)
-		if len(user) > 0 && u.Email == user[0].Email {
-			// パスワード検証
-			if !compareHashedPassword(user[0].Password, u.Password) {
-				// ログイン認証エラー（パスワード誤り）
-				logger.Log.Info("パスワードが違います")
-				logger.Log.Info("ログイン認証API終了")
-				return echo.ErrUnauthorized
-			}
-			// トークン生成
-			// ヘッダのセット
-			token := jwt.New(jwt.SigningMethodHS256)
-			// クレームのセット
-			claims := token.Claims.(jwt.MapClaims)
-			// トークンの発行日時
-			claims["iat"] = time.Now()
-			// トークンの有効期限（3日）
-			claims["exp"] = time.Now().Add(time.Hour * 72).Unix()
-			claims["userId"] = user[0].Id
-			// 署名
-			t, err := token.SignedString([]byte(config.Config.Secret))
-			if err != nil {
-				return err
-			}
-			logger.Log.Info("ログイン認証API終了")
-			return context.JSON(http.StatusOK, map[string]interface{}{
-				"token": t,
-				"admin": user[0].IsAdmin,
-			})
-		} else {
-			// ログイン認証エラー（ユーザ情報なし）
-			logger.Log.Info("メールアドレスかパスワードが違います")
-			logger.Log.Info("ログイン認証API終了")
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("ログイン認証API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	// jwt認証
+	var user []model.MstUser
+	s.DB.Where("email = ?", u.Email).Find(&user)
+	if len(user) > 0 && u.Email == user[0].Email {
+		// パスワード検証
+		if !compareHashedPassword(user[0].Password, u.Password) {
+			// ログイン認証エラー（パスワード誤り）
+			s.Logger.Info("パスワードが違います")
+			s.Logger.Info("ログイン認証API終了")
 			return echo.ErrUnauthorized
 		}
+		// 利用停止中のユーザはログインできない
+		if !user[0].Active() {
+			s.Logger.Info("利用停止中のユーザです", zap.Float64("userId", user[0].Id))
+			s.Logger.Info("ログイン認証API終了")
+			return context.JSON(http.StatusForbidden, map[string]interface{}{
+				"message": "利用停止中のユーザです",
+			})
+		}
+		// ログインセッションを作成し、アクセストークンとリフレッシュトークンを発行
+		s.Logger.Info("ログイン認証API終了")
+		return s.startSession(context, user[0])
+	} else {
+		// ログイン認証エラー（ユーザ情報なし）
+		s.Logger.Info("メールアドレスかパスワードが違います")
+		s.Logger.Info("ログイン認証API終了")
+		return echo.ErrUnauthorized
 	}
 }
 
 // ユーザ登録
-func PostUser() echo.HandlerFunc {
-	return func(context echo.Context) error {
-		logger.Log.Info("ユーザ登録API開始")
-		// DB接続
-		db, err := db.SqlConnect()
-		if err != nil {
-			return context.String(http.StatusBadGateway, err.Error())
-		} else {
-			// ログ出力有効
-			db.LogMode(true)
-			fmt.Println("Successfully connect database..")
-		}
-		// DBクローズ（遅延）
-		defer db.Close()
-		// リクエストボディーを構造体にバインド
-		u := new(model.UserParams)
-		if err = context.Bind(u); err != nil {
-			logger.Log.Info("ユーザ登録パラメータバインド失敗")
-			logger.Log.Info("ユーザ登録API終了")
-			return context.JSON(http.StatusBadRequest, err.Error())
-		}
-		// バリデーション
-		validate := validator.New()
-		// バリデーションエラーメッセージの加工
-		var errorMessages []string
-		if err := validate.Struct(u); err != nil {
-			for _, err := range err.(validator.ValidationErrors) {
-				var errMsg string
-				fieldName := err.Field()
-				switch fieldName {
-				case "Email":
-					var tag = err.Tag()
-					switch tag {
-					case "required":
-						errMsg = "メールアドレスは必須項目です"
-					case "email":
-						errMsg = "メールアドレスのフォーマットが不正です"
-					}
-				case "Username":
-					errMsg = "ユーザー名は必須項目です"
-				case "Password":
-					errMsg = "パスワードは必須項目です"
-				case "Photo":
-					var tag = err.Tag()
-					fmt.Println("tag", tag)
-					switch tag {
-					case "required":
-						errMsg = "写真は必須項目です"
-					case "base64":
-						errMsg = "写真のフォーマットが不正です"
+func (s *Server) PostUser(context echo.Context) error {
+	s.Logger.Info("ユーザ登録API開始")
+	// リクエストボディーを構造体にバインド
+	u := new(model.UserParams)
+	if err := context.Bind(u); err != nil {
+		s.Logger.Info("ユーザ登録パラメータバインド失敗")
+		s.Logger.Info("ユーザ登録API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	// バリデーション
+	validate := validator.New()
+	// バリデーションエラーメッセージの加工
+	var errorMessages []string
+	if err := validate.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			var errMsg string
+			fieldName := err.Field()
+			switch fieldName {
+			case "Email":
+				var tag = err.Tag()
+				switch tag {
+				case "required":
+					errMsg = "メールアドレスは必須項目です"
+				case "email":
+					errMsg = "メールアドレスのフォーマットが不正です"
+				}
+			case "Username":
+				errMsg = "ユーザー名は必須項目です"
+			case "Password":
+				errMsg = "パスワードは必須項目です"
+			case "Photo":
+				switch err.Tag() {
+				case "required":
+					errMsg = "写真は必須項目です"
+				case "base64":
+					errMsg = "写真のフォーマットが不正です"
 
-					}
 				}
-				errorMessages = append(errorMessages, errMsg)
 			}
-			fmt.Println("errMsg：", errorMessages)
-			logger.Log.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
-			logger.Log.Info("ユーザ登録API終了")
-			return context.JSON(http.StatusBadRequest, errorMessages)
+			errorMessages = append(errorMessages, errMsg)
 		}
-		// メールアドレス重複チェック
-		chkUser := model.MstUser{}
-		var count int = 0
-		db.Model(&chkUser).Where("email = ?", u.Email).Count(&count)
-		if count > 0 {
-			errorMessages = append(errorMessages, "既に存在するメールアドレスです")
-			logger.Log.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
-			logger.Log.Info("ユーザ登録API終了")
-			return context.JSON(http.StatusBadRequest, errorMessages)
-		}
-		// 画像アップロード
-		// 一意なファイル名生成
-		fileId := xid.New()
-		logger.Log.Info("ファイル名", zap.String("fileId", fileId.String()))
-		s3url, err := aws.PutToS3(u.Photo, fileId.String(), "png")
-		if err != nil {
-			logger.Log.Info("アップロードエラー発生")
-			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"message": "画像を登録できませんでした",
-			})
-		}
-		logger.Log.Info("生成した画像URL", zap.String("s3Url", s3url))
-		// ユーザ登録
-		createUser := model.MstUser{}
-		createUser.Email = u.Email
-		createUser.Username = u.Username
-		createUser.Password = toHashPassword(u.Password)
-		createUser.Photo = s3url
-		createUser.S3Key = fileId.String()
-		// トランザクション開始
-		tx := db.Begin()
-		defer tx.Close()
-		if err := tx.Create(&createUser).Error; err != nil {
-			logger.Log.Info("ユーザ登録失敗")
-			logger.Log.Info("ユーザ登録API終了")
-			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"message": "ユーザテーブルへ登録できませんでした",
-			})
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("ユーザ登録API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	// メールアドレス重複チェック
+	chkUser := model.MstUser{}
+	var count int = 0
+	// 削除済みのユーザも履歴に残るため、メールアドレスは再利用できない
+	s.DB.Unscoped().Model(&chkUser).Where("email = ?", u.Email).Count(&count)
+	if count > 0 {
+		errorMessages = append(errorMessages, "既に存在するメールアドレスです")
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("ユーザ登録API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	// 顔写真の品質確認（顔が1つだけ、はっきり写っている写真のみ登録する）
+	reasons, err := s.checkEnrollmentPhoto(u.Photo)
+	if err != nil {
+		s.Logger.Info("顔写真の品質確認失敗", zap.String("error", err.Error()))
+		s.Logger.Info("ユーザ登録API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "顔写真を確認できませんでした",
+		})
+	}
+	if len(reasons) > 0 {
+		s.Logger.Info("顔写真が登録に適していません", zap.Strings("理由", qualityReasonCodes(reasons)))
+		s.Logger.Info("ユーザ登録API終了")
+		return poorPhotoResponse(context, reasons)
+	}
+	// 画像アップロード
+	// 一意なファイル名生成
+	fileId := xid.New()
+	s.Logger.Info("ファイル名", zap.String("fileId", fileId.String()))
+	imageUrl, photo, err := s.putPhoto(fileId.String(), u.Photo)
+	if err != nil {
+		s.Logger.Info("アップロードエラー発生")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "画像を登録できませんでした",
+		})
+	}
+	s.Logger.Info("生成した画像URL", zap.String("imageUrl", imageUrl))
+	// ユーザ登録
+	createUser := model.MstUser{}
+	createUser.Email = u.Email
+	createUser.Username = u.Username
+	createUser.Password = toHashPassword(u.Password)
+	createUser.Photo = imageUrl
+	createUser.S3Key = fileId.String()
+	// 登録直後は一般ユーザ（ロールの変更は管理者が行う）
+	createUser.Role = string(auth.RoleMember)
+	createUser.Status = model.UserStatusActive
+	// トランザクション開始
+	tx := s.DB.Begin()
+	// コミットせずに終了した場合はロールバック（共有のコネクションプールは閉じない）
+	defer tx.RollbackUnlessCommitted()
+	err = tx.Create(&createUser).Error
+	enrollment := model.FaceEnrollment{}
+	if err == nil {
+		// 登録時の写真を顔写真の1版目とする
+		enrollment, err = s.enroll(tx, createUser, fileId.String(), imageUrl, "")
+	}
+	if err != nil {
+		s.Logger.Info("ユーザ登録失敗", zap.String("error", err.Error()))
+		// 登録できなかったユーザの画像は残さない
+		if err := s.Store.Delete(fileId.String()); err != nil {
+			s.Logger.Info("画像削除失敗", zap.String("fileId", fileId.String()))
 		}
-		// コミット
-		tx.Commit()
-		logger.Log.Info("ユーザ登録API終了")
-		return context.String(http.StatusOK, "")
+		s.Logger.Info("ユーザ登録API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ユーザテーブルへ登録できませんでした",
+		})
+	}
+	// コミット
+	tx.Commit()
+	s.indexEnrolled(&enrollment, matcher.Image{Key: fileId.String(), Bytes: photo})
+	s.Logger.Info("ユーザ登録API終了")
+	return context.String(http.StatusOK, "")
+}
+
+// ロール変更（管理者のみ）
+func (s *Server) PutUserRole(context echo.Context) error {
+	s.Logger.Info("ロール変更API開始")
+	params := new(model.RoleParams)
+	if err := context.Bind(params); err != nil {
+		s.Logger.Info("ロール変更パラメータバインド失敗")
+		s.Logger.Info("ロール変更API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	role := auth.Role(params.Role)
+	if !role.Valid() {
+		s.Logger.Info("パラメータエラー", zap.String("role", params.Role))
+		s.Logger.Info("ロール変更API終了")
+		return context.JSON(http.StatusBadRequest, []string{"ロールはadmin、operator、kiosk、memberのいずれかを指定してください"})
+	}
+	user := model.MstUser{}
+	s.DB.Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		s.Logger.Info("ロール変更API終了")
+		return context.JSON(http.StatusNotFound, map[string]interface{}{
+			"message": "ユーザが見つかりません",
+		})
+	}
+	// 管理者がいなくならないよう、自身の管理者ロールは外せない
+	if user.Id == currentUser(context).Id && role != auth.RoleAdmin {
+		s.Logger.Info("自身の管理者ロールは変更できません")
+		s.Logger.Info("ロール変更API終了")
+		return context.JSON(http.StatusBadRequest, []string{"自身の管理者ロールは変更できません"})
+	}
+	// 既存の管理者フラグ（is_admin）はadminロールと同期する
+	updates := map[string]interface{}{
+		"role":     string(role),
+		"is_admin": role == auth.RoleAdmin,
+	}
+	// 設置場所は顔認証端末にのみ設定する
+	if role != auth.RoleKiosk {
+		updates["location"] = ""
+	}
+	if err := s.DB.Model(&user).Updates(updates).Error; err != nil {
+		s.Logger.Info("ロール変更失敗", zap.String("error", err.Error()))
+		s.Logger.Info("ロール変更API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ロールを変更できませんでした",
+		})
+	}
+	user.Role = string(role)
+	user.IsAdmin = role == auth.RoleAdmin
+	if role != auth.RoleKiosk {
+		user.Location = ""
 	}
+	s.Logger.Info("ロール変更API終了", zap.Float64("userId", user.Id), zap.String("role", string(role)))
+	return context.JSON(http.StatusOK, s.withUserPhoto(user))
 }
 
 // パスワードハッシュ化
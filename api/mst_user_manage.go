@@ -0,0 +1,246 @@
+package api
+
+import (
+	"face-recognition/model"
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+)
+
+// 自身のユーザ情報取得
+func (s *Server) GetMe(context echo.Context) error {
+	return context.JSON(http.StatusOK, s.withUserPhoto(currentUser(context)))
+}
+
+// 自身のユーザ情報更新
+// メールアドレス・パスワードの変更には現在のパスワードが必要で、パスワードを変更した場合は他のセッションを失効させる
+func (s *Server) PatchMe(context echo.Context) error {
+	s.Logger.Info("ユーザ情報更新API開始")
+	params := new(model.ProfileUpdateParams)
+	if err := context.Bind(params); err != nil {
+		s.Logger.Info("ユーザ情報更新パラメータバインド失敗")
+		s.Logger.Info("ユーザ情報更新API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New()
+	if err := validate.Struct(params); err != nil {
+		errorMessages := userUpdateMessages(err)
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("ユーザ情報更新API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	user := currentUser(context)
+	if (params.Email != nil || params.Password != nil) && !compareHashedPassword(user.Password, params.CurrentPassword) {
+		s.Logger.Info("現在のパスワードが違います", zap.Float64("userId", user.Id))
+		s.Logger.Info("ユーザ情報更新API終了")
+		return context.JSON(http.StatusBadRequest, []string{"現在のパスワードが違います"})
+	}
+	if params.Email != nil && s.emailExists(*params.Email, user.Id) {
+		s.Logger.Info("ユーザ情報更新API終了")
+		return context.JSON(http.StatusBadRequest, []string{"既に存在するメールアドレスです"})
+	}
+	updates := map[string]interface{}{}
+	if params.Email != nil {
+		updates["email"] = *params.Email
+	}
+	if params.Username != nil {
+		updates["username"] = *params.Username
+	}
+	if params.Password != nil {
+		updates["password"] = toHashPassword(*params.Password)
+	}
+	tx := s.DB.Begin()
+	// コミットせずに終了した場合はロールバック（共有のコネクションプールは閉じない）
+	defer tx.RollbackUnlessCommitted()
+	if err := updateUser(tx, user, updates); err != nil {
+		s.Logger.Info("ユーザ情報更新失敗", zap.String("error", err.Error()))
+		s.Logger.Info("ユーザ情報更新API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ユーザ情報を更新できませんでした",
+		})
+	}
+	// パスワードを変更したら、他の端末のログインを取り消す
+	if params.Password != nil {
+		session := currentSession(context)
+		if err := s.revokeSessions(tx.Where("mst_user_id = ? AND id <> ?", user.Id, session.Id)); err != nil {
+			s.Logger.Info("ログインセッション失効失敗", zap.String("error", err.Error()))
+			s.Logger.Info("ユーザ情報更新API終了")
+			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+				"message": "ユーザ情報を更新できませんでした",
+			})
+		}
+	}
+	tx.Commit()
+	s.Logger.Info("ユーザ情報更新API終了", zap.Float64("userId", user.Id))
+	return s.userResponse(context, user.Id)
+}
+
+// ユーザ情報取得（管理者のみ）
+func (s *Server) GetUserById(context echo.Context) error {
+	user := model.MstUser{}
+	s.DB.Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		return userNotFound(context)
+	}
+	return context.JSON(http.StatusOK, s.withUserPhoto(user))
+}
+
+// ユーザ情報更新（管理者のみ）
+// 利用停止にした場合はそのユーザのすべてのセッションを失効させる
+func (s *Server) PatchUser(context echo.Context) error {
+	s.Logger.Info("ユーザ更新API開始")
+	params := new(model.UserUpdateParams)
+	if err := context.Bind(params); err != nil {
+		s.Logger.Info("ユーザ更新パラメータバインド失敗")
+		s.Logger.Info("ユーザ更新API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New()
+	if err := validate.Struct(params); err != nil {
+		errorMessages := userUpdateMessages(err)
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("ユーザ更新API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	user := model.MstUser{}
+	s.DB.Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		s.Logger.Info("ユーザ更新API終了")
+		return userNotFound(context)
+	}
+	suspend := params.Status != nil && *params.Status == model.UserStatusSuspended
+	if suspend && user.Id == currentUser(context).Id {
+		s.Logger.Info("自身を利用停止にはできません")
+		s.Logger.Info("ユーザ更新API終了")
+		return context.JSON(http.StatusBadRequest, []string{"自身を利用停止にはできません"})
+	}
+	if params.Email != nil && s.emailExists(*params.Email, user.Id) {
+		s.Logger.Info("ユーザ更新API終了")
+		return context.JSON(http.StatusBadRequest, []string{"既に存在するメールアドレスです"})
+	}
+	updates := map[string]interface{}{}
+	if params.Email != nil {
+		updates["email"] = *params.Email
+	}
+	if params.Username != nil {
+		updates["username"] = *params.Username
+	}
+	if params.Status != nil {
+		updates["status"] = *params.Status
+	}
+	tx := s.DB.Begin()
+	// コミットせずに終了した場合はロールバック（共有のコネクションプールは閉じない）
+	defer tx.RollbackUnlessCommitted()
+	if err := updateUser(tx, user, updates); err != nil {
+		s.Logger.Info("ユーザ更新失敗", zap.String("error", err.Error()))
+		s.Logger.Info("ユーザ更新API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ユーザを更新できませんでした",
+		})
+	}
+	if suspend {
+		if err := s.revokeSessions(tx.Where("mst_user_id = ?", user.Id)); err != nil {
+			s.Logger.Info("ログインセッション失効失敗", zap.String("error", err.Error()))
+			s.Logger.Info("ユーザ更新API終了")
+			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+				"message": "ユーザを更新できませんでした",
+			})
+		}
+	}
+	tx.Commit()
+	s.Logger.Info("ユーザ更新API終了", zap.Float64("userId", user.Id))
+	return s.userResponse(context, user.Id)
+}
+
+// ユーザ削除（管理者のみ）
+// 顔認証結果の履歴を残すため論理削除とし、顔写真を利用終了にしてすべてのセッションを失効させる
+func (s *Server) DeleteUser(context echo.Context) error {
+	s.Logger.Info("ユーザ削除API開始")
+	user := model.MstUser{}
+	s.DB.Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		s.Logger.Info("ユーザ削除API終了")
+		return userNotFound(context)
+	}
+	if user.Id == currentUser(context).Id {
+		s.Logger.Info("自身は削除できません")
+		s.Logger.Info("ユーザ削除API終了")
+		return context.JSON(http.StatusBadRequest, []string{"自身は削除できません"})
+	}
+	tx := s.DB.Begin()
+	// コミットせずに終了した場合はロールバック（共有のコネクションプールは閉じない）
+	defer tx.RollbackUnlessCommitted()
+	// 顔写真はすべて利用終了にし、顔識別の候補にしない
+	faceIds, err := s.deactivateEnrollments(tx.Where("mst_user_id = ?", user.Id))
+	if err == nil {
+		err = tx.Delete(&user).Error
+	}
+	if err != nil {
+		s.Logger.Info("ユーザ削除失敗", zap.String("error", err.Error()))
+		s.Logger.Info("ユーザ削除API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ユーザを削除できませんでした",
+		})
+	}
+	if err := s.revokeSessions(tx.Where("mst_user_id = ?", user.Id)); err != nil {
+		s.Logger.Info("ログインセッション失効失敗", zap.String("error", err.Error()))
+		s.Logger.Info("ユーザ削除API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ユーザを削除できませんでした",
+		})
+	}
+	tx.Commit()
+	s.removeFaces(faceIds)
+	s.Logger.Info("ユーザ削除API終了", zap.Float64("userId", user.Id))
+	return context.NoContent(http.StatusNoContent)
+}
+
+// 指定した項目のみ更新する（項目がなければ何もしない）
+func updateUser(tx *gorm.DB, user model.MstUser, updates map[string]interface{}) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	return tx.Model(&user).Updates(updates).Error
+}
+
+// 更新後のユーザ情報を返却
+func (s *Server) userResponse(context echo.Context, id float64) error {
+	user := model.MstUser{}
+	s.DB.Where("id = ?", id).Find(&user)
+	return context.JSON(http.StatusOK, s.withUserPhoto(user))
+}
+
+// 他のユーザが利用中のメールアドレスか（削除済みのユーザを含む）
+func (s *Server) emailExists(email string, excludeId float64) bool {
+	var count int
+	s.DB.Unscoped().Model(&model.MstUser{}).Where("email = ? AND id <> ?", email, excludeId).Count(&count)
+	return count > 0
+}
+
+func userNotFound(context echo.Context) error {
+	return context.JSON(http.StatusNotFound, map[string]interface{}{
+		"message": "ユーザが見つかりません",
+	})
+}
+
+// ユーザ更新のバリデーションエラーメッセージ
+func userUpdateMessages(err error) []string {
+	var errorMessages []string
+	for _, err := range err.(validator.ValidationErrors) {
+		var errMsg string
+		switch err.Field() {
+		case "Email":
+			errMsg = "メールアドレスのフォーマットが不正です"
+		case "Username":
+			errMsg = "ユーザー名は1〜16文字で入力してください"
+		case "Password":
+			errMsg = "パスワードを入力してください"
+		case "Status":
+			errMsg = "状態はactive、suspendedのいずれかを指定してください"
+		}
+		errorMessages = append(errorMessages, errMsg)
+	}
+	return errorMessages
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/labstack/echo"
+	"github.com/skip2/go-qrcode"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// QRコード画像の大きさ（ピクセル）の範囲
+const (
+	minQrImageSize = 64
+	maxQrImageSize = 2048
+)
+
+// QRコード画像の形式
+const (
+	qrImagePNG = "png"
+	qrImageSVG = "svg"
+)
+
+// QRコードの誤り訂正レベル（config.iniの[qr] image_recovery_levelとクエリパラメータlevelに指定する）
+var qrRecoveryLevels = map[string]qrcode.RecoveryLevel{
+	"low":     qrcode.Low,
+	"medium":  qrcode.Medium,
+	"high":    qrcode.High,
+	"highest": qrcode.Highest,
+}
+
+// QRトークンのQRコード画像（PNG）
+func (s *Server) GetQrTokenPNG(context echo.Context) error {
+	return s.qrTokenImage(context, qrImagePNG)
+}
+
+// QRトークンのQRコード画像（SVG）
+func (s *Server) GetQrTokenSVG(context echo.Context) error {
+	return s.qrTokenImage(context, qrImageSVG)
+}
+
+// 現在のQRトークンをQRコード画像にして返す
+// 大きさと誤り訂正レベルはクエリパラメータ（size・level）で指定し、省略時は設定値を使う
+func (s *Server) qrTokenImage(context echo.Context, format string) error {
+	s.Logger.Info("QRコード画像取得API開始", zap.String("format", format))
+	size := s.QrImageSize
+	level := s.QrImageRecoveryLevel
+	var errorMessages []string
+	if v := context.QueryParam("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minQrImageSize || n > maxQrImageSize {
+			errorMessages = append(errorMessages, fmt.Sprintf("サイズは%d〜%dで指定してください", minQrImageSize, maxQrImageSize))
+		}
+		size = n
+	}
+	if v := context.QueryParam("level"); v != "" {
+		level = v
+	}
+	recoveryLevel, ok := qrRecoveryLevels[level]
+	if !ok {
+		errorMessages = append(errorMessages, "誤り訂正レベルはlow・medium・high・highestのいずれかを指定してください")
+	}
+	if len(errorMessages) > 0 {
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("QRコード画像取得API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	userId := currentUser(context).Id
+	qrToken, err := s.currentQrToken(userId)
+	if err != nil {
+		s.Logger.Info("QRトークンテーブル登録失敗", zap.String("error", err.Error()))
+		s.Logger.Info("QRコード画像取得API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "QRトークンテーブルへ登録できませんでした",
+		})
+	}
+	code, err := qrcode.New(qrToken.QrToken, recoveryLevel)
+	var data []byte
+	if err == nil {
+		if format == qrImagePNG {
+			data, err = code.PNG(size)
+		} else {
+			data = qrSVG(code.Bitmap(), size)
+		}
+	}
+	if err != nil {
+		s.Logger.Info("QRコード生成失敗", zap.String("error", err.Error()))
+		s.Logger.Info("QRコード画像取得API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "QRコードを生成できませんでした",
+		})
+	}
+	// トークンはローテーションするため、画像をキャッシュさせず有効期限を添える
+	context.Response().Header().Set("Cache-Control", "no-store")
+	context.Response().Header().Set("X-Qr-Token-Expires-At", qrToken.ExpiresAt.Format(time.RFC3339))
+	s.Logger.Info("QRコード画像取得API終了", zap.Float64("userId", userId), zap.Int("size", size), zap.String("level", level))
+	if format == qrImagePNG {
+		return context.Blob(http.StatusOK, "image/png", data)
+	}
+	return context.Blob(http.StatusOK, "image/svg+xml", data)
+}
+
+// QRコードのモジュール（周囲の余白を含む）をSVGにする
+// 1モジュールを1単位とし、横に連続する黒いモジュールは1つの矩形にまとめる
+func qrSVG(bitmap [][]bool, size int) []byte {
+	var buf bytes.Buffer
+	n := len(bitmap)
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
@@ -1,231 +1,410 @@
 package api
 
 import (
-	"face-recognition/aws"
-	"face-recognition/config"
-	"face-recognition/db"
-	"face-recognition/logger"
+	"encoding/base64"
+	"face-recognition/matcher"
 	"face-recognition/model"
-	"fmt"
+	"face-recognition/policy"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo"
 	"github.com/rs/xid"
 	"go.uber.org/zap"
 	"gopkg.in/go-playground/validator.v9"
 	"net/http"
 	"strconv"
-	"time"
+	"strings"
 )
 
 // QRトークン取得
-func GetQrToken() echo.HandlerFunc {
-	return func(context echo.Context) error {
-		logger.Log.Info("QRトークン取得API開始")
-		// DB接続
-		db, err := db.SqlConnect()
-		if err != nil {
-			return context.String(http.StatusBadGateway, err.Error())
-		} else {
-			// ログ出力有効
-			db.LogMode(true)
-			fmt.Println("Successfully connect database..")
-		}
-		// DBクローズ（遅延）
-		defer db.Close()
+func (s *Server) GetQrToken(context echo.Context) error {
+	s.Logger.Info("QRトークン取得API開始")
+	// トークンからユーザ特定
+	user := context.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	userId := claims["userId"].(float64)
+	s.Logger.Info("QRトークン取得API", zap.String("User", strconv.FormatFloat(userId, 'f', -1, 64)))
+	qrToken, err := s.currentQrToken(userId)
+	if err != nil {
+		s.Logger.Info("QRトークンテーブル登録失敗", zap.String("error", err.Error()))
+		s.Logger.Info("QRトークン取得API終了", zap.String("User", strconv.FormatFloat(userId, 'f', -1, 64)))
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "QRトークンテーブルへ登録できませんでした",
+		})
+	}
+	s.Logger.Info("QRトークン取得API終了", zap.String("User", strconv.FormatFloat(userId, 'f', -1, 64)))
+	qrToken.MstUser = s.withUserPhoto(qrToken.MstUser)
+	return context.JSON(http.StatusOK, qrToken)
+}
 
-		// トークンからユーザ特定
-		user := context.Get("user").(*jwt.Token)
-		claims := user.Claims.(jwt.MapClaims)
-		userId := claims["userId"].(float64)
-		logger.Log.Info("QRトークン取得API", zap.String("User", strconv.FormatFloat(userId,'f', -1, 64)))
-		// qr_tokenテーブルにレコードが存在すれば返却する
-		qrToken := model.QrToken{}
-		// プリロードを利用すれば、1センテンスで複数のテーブルからデータを取得
-		// モデル間の関係を持っていることが前提
-		db.Where("mst_user_id = ?", userId).Preload("MstUser").Find(&qrToken)
-		// QRトークンが存在しなければ、データを作成して返却する
-		if qrToken.Id == 0 {
-			logger.Log.Info("qr_tokenテーブルにレコードが存在しないため、登録データを作成")
-			// トークン生成
-			token := jwt.New(jwt.SigningMethodHS256)
-			claims := token.Claims.(jwt.MapClaims)
-			claims["iat"] = time.Now()
-			claims["userId"] = userId
-			// 署名
-			t, err := token.SignedString([]byte(config.Config.Secret))
-			if err != nil {
-				return err
-			}
-			// qr_tokenテーブルへの投入データ作成
-			qrToken.QrToken = t
-			qrToken.MstUserId = userId
-			// トランザクション開始
-			tx := db.Begin()
-			defer tx.Close()
-			if err := tx.Create(&qrToken).Error; err != nil {
-				logger.Log.Info("QRトークンテーブル登録失敗")
-				logger.Log.Info("QRトークン取得API終了", zap.String("User", strconv.FormatFloat(userId,'f', -1, 64)))
-				return context.JSON(http.StatusInternalServerError, map[string]interface{}{
-					"message": "QRトークンテーブルへ登録できませんでした",
-				})
-			}
-			// コミット
-			tx.Commit()
-			db.Preload("MstUser").Find(&qrToken)
-			logger.Log.Info("QRトークン取得API終了", zap.String("User", strconv.FormatFloat(userId,'f', -1, 64)))
-			return context.JSON(http.StatusOK, qrToken)
-		}
-		// 既にQRトークンテーブルにレコードが存在する場合にはそのトークンを返却する
-		logger.Log.Info("QRトークン取得API終了", zap.String("User", strconv.FormatFloat(userId,'f', -1, 64)))
-		return context.JSON(http.StatusOK, qrToken)
+// ユーザの現在のQRトークンを返す（ユーザマスタをプリロードする）
+// 画面のスクリーンショットを使い回せないよう、ローテーションの間隔を過ぎたトークンは新しいトークンに置き換える
+func (s *Server) currentQrToken(userId float64) (model.QrToken, error) {
+	// qr_tokenテーブルにレコードが存在すれば返却する
+	qrToken := model.QrToken{}
+	// プリロードを利用すれば、1センテンスで複数のテーブルからデータを取得
+	// モデル間の関係を持っていることが前提
+	s.DB.Where("mst_user_id = ?", userId).Preload("MstUser").Find(&qrToken)
+	now := s.Clock()
+	// ローテーションの間隔内で使い切っていないトークンであればそのトークンを返却する
+	if qrToken.Id != 0 && qrToken.Active(now) && now.Before(qrToken.IssuedAt.Add(s.QrTokenRotationInterval)) && !qrToken.UsedUp(s.QrTokenMaxUses) {
+		return qrToken, nil
+	}
+	// QRトークンが存在しないか古ければ、新しいトークンを発行して返却する（以前のトークンは顔認証に使えなくなる）
+	s.Logger.Info("QRトークンを発行", zap.Bool("ローテーション", qrToken.Id != 0))
+	// トークン生成
+	// jtiはトークンごとに一意にし、顔認証に成功した回数を記録する
+	jti := xid.New().String()
+	claims := jwt.MapClaims{}
+	claims["jti"] = jti
+	claims["iat"] = now
+	claims["exp"] = now.Add(s.QrTokenTTL).Unix()
+	claims["userId"] = userId
+	// QRトークン用の鍵で署名
+	t, err := s.QrKeys.Sign(claims)
+	if err != nil {
+		return model.QrToken{}, err
 	}
+	// qr_tokenテーブルへの投入データ作成
+	values := map[string]interface{}{
+		"qr_token":   t,
+		"jti":        jti,
+		"issued_at":  now,
+		"expires_at": now.Add(s.QrTokenTTL),
+		"use_count":  0,
+	}
+	// トランザクション開始
+	tx := s.DB.Begin()
+	// コミットせずに終了した場合はロールバック（共有のコネクションプールは閉じない）
+	defer tx.RollbackUnlessCommitted()
+	if qrToken.Id == 0 {
+		qrToken = model.QrToken{MstUserId: userId, QrToken: t, Jti: jti, IssuedAt: now, ExpiresAt: now.Add(s.QrTokenTTL)}
+		err = tx.Create(&qrToken).Error
+	} else {
+		err = tx.Model(&model.QrToken{}).Where("id = ?", qrToken.Id).Updates(values).Error
+	}
+	if err != nil {
+		return model.QrToken{}, err
+	}
+	// コミット
+	if err := tx.Commit().Error; err != nil {
+		return model.QrToken{}, err
+	}
+	issued := model.QrToken{}
+	s.DB.Where("id = ?", qrToken.Id).Preload("MstUser").Find(&issued)
+	return issued, nil
 }
 
 // 顔認証
-func PostFaceRecognition() echo.HandlerFunc {
-	return func(context echo.Context) error {
-		logger.Log.Info("顔認証API開始")
-		// DB接続
-		db, err := db.SqlConnect()
-		if err != nil {
-			return context.String(http.StatusBadGateway, err.Error())
-		} else {
-			// ログ出力有効
-			db.LogMode(true)
-			fmt.Println("Successfully connect database..")
-		}
-		// DBクローズ（遅延）
-		defer db.Close()
-		// リクエストボディーを構造体にバインド
-		face := new(model.FaceRecognitionParams)
-		if err = context.Bind(face); err != nil {
-			logger.Log.Info("顔認証情報パラメータバインド失敗")
-			logger.Log.Info("顔認証API終了")
-			return context.JSON(http.StatusBadRequest, err.Error())
-		}
-		// バリデーション
-		validate := validator.New()
-		var errorMessages []string
-		if err := validate.Struct(face); err != nil {
-			for _, err := range err.(validator.ValidationErrors) {
-				var errMsg string
-				fieldName := err.Field()
-				switch fieldName {
-				case "QrToken":
-					errMsg = "QRトークンは必須項目です"
-				case "Photo":
-					var tag = err.Tag()
-					fmt.Println("tag", tag)
-					switch tag {
-					case "required":
-						errMsg = "写真は必須項目です"
-					case "base64":
-						errMsg = "写真のフォーマットが不正です"
+func (s *Server) PostFaceRecognition(context echo.Context) error {
+	s.Logger.Info("顔認証API開始")
+	// リクエストボディーを構造体にバインド
+	face := new(model.FaceRecognitionParams)
+	if err := context.Bind(face); err != nil {
+		s.Logger.Info("顔認証情報パラメータバインド失敗")
+		s.Logger.Info("顔認証API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	// バリデーション
+	validate := validator.New()
+	var errorMessages []string
+	if err := validate.Struct(face); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+			var errMsg string
+			fieldName := err.Field()
+			switch fieldName {
+			case "QrToken":
+				errMsg = "QRトークンは必須項目です"
+			case "Photo":
+				switch err.Tag() {
+				case "required":
+					errMsg = "写真は必須項目です"
+				case "base64":
+					errMsg = "写真のフォーマットが不正です"
 
-					}
 				}
-				errorMessages = append(errorMessages, errMsg)
+			case "Location":
+				errMsg = "設置場所は64文字以内で指定してください"
+			case "ChallengeId":
+				errMsg = "チャレンジIDが不正です"
+			case "Frames":
+				errMsg = "フレームは10枚以内で指定してください"
+			default:
+				// フレームごとのエラー（Frames[0]など）
+				if strings.HasPrefix(fieldName, "Frames[") {
+					errMsg = "フレームのフォーマットが不正です"
+				}
 			}
-			fmt.Println("errMsg：", errorMessages)
-			logger.Log.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
-			logger.Log.Info("顔認証API終了")
-			return context.JSON(http.StatusBadRequest, errorMessages)
+			errorMessages = append(errorMessages, errMsg)
 		}
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("顔認証API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	// ライブネスチャレンジはチャレンジIDとフレームの両方が必要
+	switch {
+	case face.ChallengeId == "" && len(face.Frames) > 0:
+		errorMessages = append(errorMessages, "チャレンジIDは必須項目です")
+	case face.ChallengeId != "" && len(face.Frames) == 0:
+		errorMessages = append(errorMessages, "フレームは必須項目です")
+	case face.ChallengeId == "" && s.LivenessRequired:
+		errorMessages = append(errorMessages, "ライブネスチャレンジは必須です")
+	}
+	location, ok := kioskLocation(context, face.Location)
+	if !ok {
+		errorMessages = append(errorMessages, "設置場所が端末の設定と一致しません")
+	}
+	if len(errorMessages) > 0 {
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("顔認証API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+
+	// qrトークン（jwt）をデコード
+	tokenString := face.QrToken
+	claims := jwt.MapClaims{}
+	// QRトークン用の鍵で検証する（セッション用のトークンは受け付けない）
+	_, err := s.QrKeys.Parse(tokenString, claims)
+	if verr, ok := err.(*jwt.ValidationError); ok && verr.Errors == jwt.ValidationErrorExpired {
+		s.Logger.Info("QRトークンの有効期限切れ")
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return qrTokenExpired(context)
+	}
+	if err != nil {
+		s.Logger.Info("QRトークンからデコード失敗")
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "QRトークンのフォーマットが不正のため、特定できませんでした",
+		})
+	}
+	if len(claims) == 0 {
+		s.Logger.Info("QRトークンにクレーム情報がありません")
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "QRトークンのフォーマットが不正のため、特定できませんでした",
+		})
+	}
+	userId, ok := claims["userId"].(float64)
+	if !ok {
+		s.Logger.Info("QRトークンのクレーム情報に数値のuserIdがありません")
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return context.JSON(http.StatusBadRequest, map[string]interface{}{
+			"message": "QRトークンからユーザーを特定できませんでした",
+		})
+	}
+	s.Logger.Info("顔認証API", zap.String("認証User", strconv.FormatFloat(userId, 'f', -1, 64)))
+	// 置き換え済み・期限切れのQRトークンは受け付けない（スクリーンショットの使い回しを防ぐ）
+	current := model.QrToken{}
+	s.DB.Where("mst_user_id = ?", userId).Find(&current)
+	if current.QrToken != tokenString {
+		s.Logger.Info("置き換え済みのQRトークンです", zap.String("認証User", strconv.FormatFloat(userId, 'f', -1, 64)))
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return context.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"message": "QRトークンは新しいトークンに置き換えられています",
+		})
+	}
+	if !current.Active(s.Clock()) {
+		s.Logger.Info("QRトークンの有効期限切れ", zap.String("認証User", strconv.FormatFloat(userId, 'f', -1, 64)))
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return qrTokenExpired(context)
+	}
+	if current.UsedUp(s.QrTokenMaxUses) {
+		s.Logger.Info("使用済みのQRトークンです", zap.String("認証User", strconv.FormatFloat(userId, 'f', -1, 64)), zap.String("jti", current.Jti))
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return qrTokenUsed(context)
+	}
 
-		// qrトークン（jwt）をデコード
-		tokenString := face.QrToken
-		claims := jwt.MapClaims{}
-		_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.Config.Secret), nil
+	// 認証対象ユーザのプロフィール画像取得
+	mstUser := model.MstUser{}
+	s.DB.Where("id = ?", userId).Find(&mstUser)
+	if mstUser.Id == 0 {
+		s.Logger.Info("ユーザマスタに存在しません", zap.String("認証User", strconv.FormatFloat(userId, 'f', -1, 64)))
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "QRトークンからユーザーを特定できませんでした",
+		})
+	}
+	// 利用停止中のユーザは顔認証しない（結果も記録しない）
+	if !mstUser.Active() {
+		s.Logger.Info("利用停止中のユーザです", zap.String("認証User", strconv.FormatFloat(userId, 'f', -1, 64)))
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return context.JSON(http.StatusForbidden, map[string]interface{}{
+			"message": "利用停止中のユーザです",
 		})
+	}
+	// 比較元画像（利用中の顔写真すべて）を取得
+	enrollments := s.activeEnrollments(mstUser.Id)
+	if len(enrollments) == 0 {
+		s.Logger.Info("利用中の顔写真がありません", zap.String("認証User", strconv.FormatFloat(userId, 'f', -1, 64)))
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "比較元画像を取得できませんでした",
+		})
+	}
+	sourcePhotos := make([][]byte, len(enrollments))
+	for i, enrollment := range enrollments {
+		sourcePhotos[i], err = s.Store.Get(enrollment.S3Key)
 		if err != nil {
-			logger.Log.Info("QRトークンからデコード失敗")
-			logger.Log.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+			s.Logger.Info("比較元画像の取得エラー発生", zap.String("s3Key", enrollment.S3Key))
+			s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
 			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"message": "QRトークンのフォーマットが不正のため、特定できませんでした",
+				"message": "比較元画像を取得できませんでした",
 			})
 		}
-		if len(claims) == 0 {
-			logger.Log.Info("QRトークンにクレーム情報がありません")
-			logger.Log.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
-			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"message": "QRトークンのフォーマットが不正のため、特定できませんでした",
-			})
+	}
+	// ライブネスチャレンジのフレーム
+	var frames [][]byte
+	for _, f := range face.Frames {
+		frame, err := base64.StdEncoding.DecodeString(f)
+		if err != nil {
+			s.Logger.Info("base64からフレーム生成エラー", zap.String("challengeId", face.ChallengeId))
+			s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+			return context.JSON(http.StatusBadRequest, []string{"フレームのフォーマットが不正です"})
 		}
-		var userId float64 = -1
-		for key, val := range claims {
-			fmt.Printf("Key: %v, value: %v\n", key, val)
-			if key == "userId" {
-				userId = val.(float64)
+		frames = append(frames, frame)
+	}
+	// 比較対象画像を画像ストレージへアップロード
+	// 一意なファイル名（ストレージのキー）生成
+	fileId := xid.New()
+	s.Logger.Info("ファイル名", zap.String("fileId", fileId.String()))
+	imageUrl, photo, err := s.putPhoto(fileId.String(), face.Photo)
+	if err != nil {
+		s.Logger.Info("比較先画像のアップロードエラー発生")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "比較先画像をアップロードできませんでした",
+		})
+	}
+	s.Logger.Info("生成した画像URL", zap.String("imageUrl", imageUrl))
+	// 撮影した写真の顔を確認し、比較できる場合のみ顔認証を実施する
+	probe := matcher.Image{Key: fileId.String(), Bytes: photo}
+	outcome := s.checkProbe(probe)
+	// 画面・印刷物を再撮影した疑いがあれば顔写真と比較しない
+	var spoofScore *float64
+	if outcome == "" {
+		spoofScore, outcome = s.checkSpoof(photo)
+	}
+	// ライブネスチャレンジの動作を確認できた場合のみ顔写真と比較する
+	// チャレンジは1回の顔認証にのみ使える（撮影した写真を比較できる場合に利用済みにし、動作を確認できなくても再利用させない）
+	var challenge model.LivenessChallenge
+	if outcome == "" && face.ChallengeId != "" {
+		var ok bool
+		challenge, ok = s.useLivenessChallenge(face.ChallengeId, currentUser(context).Id)
+		if !ok {
+			if err := s.Store.Delete(fileId.String()); err != nil {
+				s.Logger.Info("画像削除失敗", zap.String("fileId", fileId.String()))
 			}
-		}
-		if userId == -1 {
-			logger.Log.Info("QRトークンのクレーム情報にuserIdがありません")
-			logger.Log.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
-			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"message": "QRトークンからユーザーを特定できませんでした",
+			s.Logger.Info("ライブネスチャレンジが無効です", zap.String("challengeId", face.ChallengeId))
+			s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+			return context.JSON(http.StatusBadRequest, map[string]interface{}{
+				"message": "ライブネスチャレンジが無効か期限切れです",
 			})
 		}
-		logger.Log.Info("顔認証API", zap.String("認証User", strconv.FormatFloat(userId,'f', -1, 64)))
-
-		// 認証対象ユーザのプロフィール画像取得
-		mstUser := model.MstUser{}
-		db.Where("id = ?", userId).Find(&mstUser)
-		if mstUser.Id == 0 {
-			logger.Log.Info("ユーザマスタに存在しません", zap.String("認証User", strconv.FormatFloat(userId,'f', -1, 64)))
-			logger.Log.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
-			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"message": "QRトークンからユーザーを特定できませんでした",
-			})
+		outcome = s.checkLiveness(probe, challenge.StepList(), frames)
+	}
+	// 顔認証実施（画像データを直接渡すため、ストレージの種類によらず照合できる）
+	// 利用中の顔写真ごとに比較し、最も類似度の高いものを結果とする（同じ類似度なら新しい写真）
+	best := 0
+	resp := -1.0
+	for i, enrollment := range enrollments {
+		if outcome != "" {
+			break
 		}
-		// 比較対象画像をS3へアップロード
-		// 一意なファイル名（S3のキー）生成
-		fileId := xid.New()
-		logger.Log.Info("ファイル名", zap.String("fileId", fileId.String()))
-		s3url, err := aws.PutToS3(face.Photo, fileId.String(), "png")
+		similarity, err := s.Matcher.CompareFaces(matcher.Image{Key: enrollment.S3Key, Bytes: sourcePhotos[i]}, probe)
 		if err != nil {
-			logger.Log.Info("比較先画像のS3アップロードエラー発生")
-			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"message": "比較先画像をアップロードできませんでした",
-			})
+			s.Logger.Info("顔認証失敗", zap.String("error", err.Error()), zap.Float64("enrollmentId", enrollment.Id))
+			outcome = compareOutcome(err)
+			break
 		}
-		logger.Log.Info("生成した画像URL", zap.String("s3Url", s3url))
-		// 顔認証実施
-		resp, err := aws.CompareFaces(mstUser.S3Key, fileId.String())
-		if err != nil {
-			logger.Log.Info("顔認証失敗", zap.String("error", err.Error()))
-			logger.Log.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
-			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"message": "顔認証に失敗しました",
-			})
+		if similarity > resp {
+			best, resp = i, similarity
 		}
-		// 顔認証結果テーブルへ投入
-		createFaceRecognitionResult := model.FaceRecognitionResult{}
-		createFaceRecognitionResult.MstUserId = mstUser.Id
-		createFaceRecognitionResult.SourceImage = mstUser.Photo
-		createFaceRecognitionResult.SourceImageS3Key = mstUser.S3Key
-		createFaceRecognitionResult.TargetImage = s3url
-		createFaceRecognitionResult.TargetImageS3Key = fileId.String()
-		createFaceRecognitionResult.Result = resp
-		// トランザクション開始
-		tx := db.Begin()
-		defer tx.Close()
-		if err := tx.Create(&createFaceRecognitionResult).Error; err != nil {
-			logger.Log.Info("顔認証結果登録失敗")
-			logger.Log.Info("顔認証API終了")
+	}
+	enrollment := enrollments[best]
+	s.Logger.Info("顔認証の比較結果", zap.Int("比較した写真の数", len(enrollments)), zap.Float64("enrollmentId", enrollment.Id), zap.Float64("類似度", resp))
+	// 顔認証結果テーブルへ投入（比較できなかった場合も、その理由を記録する）
+	createFaceRecognitionResult := model.FaceRecognitionResult{}
+	createFaceRecognitionResult.MstUserId = mstUser.Id
+	createFaceRecognitionResult.FaceEnrollmentId = &enrollment.Id
+	createFaceRecognitionResult.Method = model.RecognitionMethodQrToken
+	createFaceRecognitionResult.QrTokenJti = current.Jti
+	if challenge.Id != 0 {
+		createFaceRecognitionResult.LivenessChallengeId = &challenge.Id
+	}
+	createFaceRecognitionResult.SourceImage = enrollment.Photo
+	createFaceRecognitionResult.SourceImageS3Key = enrollment.S3Key
+	createFaceRecognitionResult.TargetImage = imageUrl
+	createFaceRecognitionResult.TargetImageS3Key = fileId.String()
+	createFaceRecognitionResult.Result = resp
+	createFaceRecognitionResult.SpoofScore = spoofScore
+	// 判定ポリシーのしきい値で本人かどうかを判定する（要確認は認証成功としない）
+	decision := s.settleOutcome(&createFaceRecognitionResult, mstUser, location, outcome)
+	// トランザクション開始
+	tx := s.DB.Begin()
+	// コミットせずに終了した場合はロールバック（共有のコネクションプールは閉じない）
+	defer tx.RollbackUnlessCommitted()
+	// 本人と判定した場合はQRトークンの利用回数を記録する
+	// 同時に同じトークンで顔認証された場合は、先に記録した方のみ成功させる（結果も記録しない）
+	if decision == policy.DecisionAccept {
+		redeemed, err := s.redeemQrToken(tx, current)
+		if err != nil {
+			s.Logger.Info("QRトークンの利用回数の記録失敗", zap.String("error", err.Error()))
+			s.Logger.Info("顔認証API終了")
 			return context.JSON(http.StatusInternalServerError, map[string]interface{}{
 				"message": "顔認証結果テーブルへ登録できませんでした",
 			})
 		}
-		// コミット
-		tx.Commit()
-		authResult := false
-		if resp != 0 {
-			authResult = true
+		if !redeemed {
+			s.Logger.Info("QRトークンが同時に利用されました", zap.String("jti", current.Jti))
+			s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+			return qrTokenUsed(context)
 		}
-		logger.Log.Info( "顔認証API終了", zap.String("結果", strconv.FormatBool(authResult)))
-		return context.JSON(http.StatusOK, map[string]interface{} {
-			"authResult": authResult,
+	}
+	if err := tx.Create(&createFaceRecognitionResult).Error; err != nil {
+		s.Logger.Info("顔認証結果登録失敗")
+		s.Logger.Info("顔認証API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "顔認証結果テーブルへ登録できませんでした",
+		})
+	}
+	// コミット
+	tx.Commit()
+	if createFaceRecognitionResult.Outcome == model.OutcomeBackendError {
+		s.Logger.Info("顔認証API終了", zap.String("QRトークン", face.QrToken))
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "顔認証に失敗しました",
+			"outcome": createFaceRecognitionResult.Outcome,
 		})
 	}
-}
\ No newline at end of file
+	authResult := decision == policy.DecisionAccept
+	s.Logger.Info("顔認証API終了", zap.String("結果", strconv.FormatBool(authResult)), zap.String("判定", string(decision)), zap.String("種類", createFaceRecognitionResult.Outcome))
+	return context.JSON(http.StatusOK, map[string]interface{}{
+		"authResult": authResult,
+		"decision":   decision,
+		"outcome":    createFaceRecognitionResult.Outcome,
+	})
+}
+
+// 有効期限の切れたQRトークンのレスポンス（利用者にQRトークンの再取得を促す）
+func qrTokenExpired(context echo.Context) error {
+	return context.JSON(http.StatusUnauthorized, map[string]interface{}{
+		"message": "QRトークンの有効期限が切れています",
+	})
+}
+
+// 使用済みのQRトークンのレスポンス
+func qrTokenUsed(context echo.Context) error {
+	return context.JSON(http.StatusUnauthorized, map[string]interface{}{
+		"message": "QRトークンは使用済みです",
+	})
+}
+
+// QRトークンの利用回数を1増やす（置き換え済み・使い切ったトークンの場合はfalse）
+// 条件付きの更新にし、同時に利用された場合もDBで利用できる回数を超えないようにする
+func (s *Server) redeemQrToken(tx *gorm.DB, qrToken model.QrToken) (bool, error) {
+	scope := tx.Model(&model.QrToken{}).Where("id = ? AND jti = ?", qrToken.Id, qrToken.Jti)
+	if s.QrTokenMaxUses > 0 {
+		scope = scope.Where("use_count < ?", s.QrTokenMaxUses)
+	}
+	result := scope.Update("use_count", gorm.Expr("use_count + 1"))
+	return result.RowsAffected == 1, result.Error
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"face-recognition/auth"
+	"face-recognition/logger"
+	"face-recognition/matcher"
+	"face-recognition/policy"
+	"face-recognition/spoof"
+	"face-recognition/storage"
+	"github.com/jinzhu/gorm"
+	"go.uber.org/zap"
+	"time"
+)
+
+// 現在時刻の取得（テストで時刻を固定できるよう差し替え可能にする）
+type Clock func() time.Time
+
+// APIサーバ
+// ハンドラが利用する依存関係をまとめて保持し、グローバル変数には依存しない
+type Server struct {
+	DB      *gorm.DB
+	Store   storage.ImageStore
+	Matcher matcher.FaceMatcher
+	Clock   Clock
+	Logger  *zap.Logger
+	// セッション（ログイン）用JWTの署名鍵
+	SessionKeys *auth.Keyring
+	// QRトークン用JWTの署名鍵（セッション用とは別の鍵を使う）
+	QrKeys *auth.Keyring
+	// アクセストークンの有効期限
+	AccessTokenTTL time.Duration
+	// リフレッシュトークン（ログインセッション）の有効期限
+	RefreshTokenTTL time.Duration
+	// QRトークンの有効期限とローテーションの間隔
+	QrTokenTTL              time.Duration
+	QrTokenRotationInterval time.Duration
+	// QRトークン1つで顔認証に成功できる回数（0は無制限）
+	QrTokenMaxUses int
+	// QRコード画像のデフォルトの大きさ（ピクセル）と誤り訂正レベル
+	QrImageSize          int
+	QrImageRecoveryLevel string
+	// 顔照合結果の判定ポリシー（設置場所・ユーザ個別の設定はDBから読み込む）
+	Policy policy.Policy
+	// なりすまし検知エンジン（nilなら検知しない）と、認証を拒否するスコア
+	Spoof          spoof.Detector
+	SpoofThreshold float64
+	// 顔認証にライブネスチャレンジを必須とするか
+	LivenessRequired bool
+	// ライブネスチャレンジの有効期限
+	LivenessChallengeTTL time.Duration
+}
+
+// APIサーバ生成（時刻は現在時刻、ロガーはアプリケーション共通のものを利用する。トークン・ライブネスチャレンジの有効期限、判定しきい値はデフォルト値）
+func NewServer(db *gorm.DB, store storage.ImageStore, faceMatcher matcher.FaceMatcher, sessionKeys, qrKeys *auth.Keyring) *Server {
+	return &Server{
+		DB:                      db,
+		Store:                   store,
+		Matcher:                 faceMatcher,
+		Clock:                   time.Now,
+		Logger:                  logger.Log,
+		SessionKeys:             sessionKeys,
+		QrKeys:                  qrKeys,
+		AccessTokenTTL:          15 * time.Minute,
+		RefreshTokenTTL:         30 * 24 * time.Hour,
+		QrTokenTTL:              5 * time.Minute,
+		QrTokenRotationInterval: time.Minute,
+		QrTokenMaxUses:          1,
+		QrImageSize:             256,
+		QrImageRecoveryLevel:    "medium",
+		Policy:                  policy.Policy{Default: policy.Thresholds{Accept: 90, Review: 80}},
+		SpoofThreshold:          50,
+		LivenessChallengeTTL:    time.Minute,
+	}
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"face-recognition/auth"
+	"face-recognition/model"
+	"face-recognition/textutil"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+	"strings"
+)
+
+// リフレッシュトークンの形式は"<セッションID>.<ランダム値>"
+// セッションIDでレコードを特定し、ランダム値のハッシュ値を照合する
+const refreshTokenSeparator = "."
+
+// ログインセッションを作成し、アクセストークンとリフレッシュトークンを返却する
+func (s *Server) startSession(context echo.Context, user model.MstUser) error {
+	refreshSecret, err := newRefreshSecret()
+	if err != nil {
+		return err
+	}
+	session := model.UserSession{
+		SessionId:        xid.New().String(),
+		MstUserId:        user.Id,
+		RefreshTokenHash: hashRefreshSecret(refreshSecret),
+		UserAgent:        textutil.Truncate(context.Request().UserAgent(), 255),
+		IpAddress:        context.RealIP(),
+		ExpiresAt:        s.Clock().Add(s.RefreshTokenTTL),
+	}
+	if err := s.DB.Create(&session).Error; err != nil {
+		s.Logger.Info("ログインセッション登録失敗", zap.String("error", err.Error()))
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ログインセッションを作成できませんでした",
+		})
+	}
+	return s.tokenResponse(context, user, session.SessionId, refreshSecret)
+}
+
+// アクセストークンを発行してレスポンスを返却
+func (s *Server) tokenResponse(context echo.Context, user model.MstUser, sessionId string, refreshSecret string) error {
+	// クレームのセット
+	claims := jwt.MapClaims{}
+	// トークンの発行日時
+	claims["iat"] = s.Clock()
+	// トークンの有効期限（失効はセッションで管理するため短くする）
+	claims["exp"] = s.Clock().Add(s.AccessTokenTTL).Unix()
+	claims["userId"] = user.Id
+	// セッションID（ログアウト済みのトークンを拒否するために利用する）
+	claims["sid"] = sessionId
+	// セッション用の鍵で署名（ヘッダに鍵IDを付与する）
+	t, err := s.SessionKeys.Sign(claims)
+	if err != nil {
+		return err
+	}
+	return context.JSON(http.StatusOK, map[string]interface{}{
+		"token":        t,
+		"expiresIn":    int64(s.AccessTokenTTL.Seconds()),
+		"refreshToken": sessionId + refreshTokenSeparator + refreshSecret,
+		"admin":        auth.Role(user.Role) == auth.RoleAdmin,
+		"role":         user.Role,
+	})
+}
+
+// トークン更新（リフレッシュトークンをローテーションし、新しいアクセストークンを発行する）
+func (s *Server) PostRefresh(context echo.Context) error {
+	s.Logger.Info("トークン更新API開始")
+	params := new(model.RefreshParams)
+	if err := context.Bind(params); err != nil {
+		s.Logger.Info("トークン更新パラメータバインド失敗")
+		s.Logger.Info("トークン更新API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	validate := validator.New()
+	if err := validate.Struct(params); err != nil {
+		s.Logger.Info("トークン更新API終了")
+		return context.JSON(http.StatusBadRequest, []string{"リフレッシュトークンは必須項目です"})
+	}
+	parts := strings.SplitN(params.RefreshToken, refreshTokenSeparator, 2)
+	if len(parts) != 2 {
+		s.Logger.Info("リフレッシュトークンの形式が不正です")
+		s.Logger.Info("トークン更新API終了")
+		return echo.ErrUnauthorized
+	}
+	session := model.UserSession{}
+	s.DB.Where("session_id = ?", parts[0]).Find(&session)
+	if session.Id == 0 || !session.Active(s.Clock()) {
+		s.Logger.Info("セッションが存在しないか失効しています", zap.String("sessionId", parts[0]))
+		s.Logger.Info("トークン更新API終了")
+		return echo.ErrUnauthorized
+	}
+	if subtle.ConstantTimeCompare([]byte(hashRefreshSecret(parts[1])), []byte(session.RefreshTokenHash)) != 1 {
+		// ローテーション済みのトークンが再利用された（漏洩の可能性がある）ため、セッションごと失効させる
+		s.Logger.Info("ローテーション済みのリフレッシュトークンが利用されたため、セッションを失効", zap.String("sessionId", session.SessionId))
+		s.revokeSessions(s.DB.Where("id = ?", session.Id))
+		s.Logger.Info("トークン更新API終了")
+		return echo.ErrUnauthorized
+	}
+	user := model.MstUser{}
+	s.DB.Where("id = ?", session.MstUserId).Find(&user)
+	if user.Id == 0 || !user.Active() {
+		s.Logger.Info("ユーザマスタに存在しないか利用停止中です", zap.String("sessionId", session.SessionId))
+		s.Logger.Info("トークン更新API終了")
+		return echo.ErrUnauthorized
+	}
+	refreshSecret, err := newRefreshSecret()
+	if err != nil {
+		return err
+	}
+	// 同時に同じトークンで更新された場合は、先に更新した方のみ成功させる
+	now := s.Clock()
+	result := s.DB.Model(&model.UserSession{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.Id, session.RefreshTokenHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash": hashRefreshSecret(refreshSecret),
+			"last_used_at":       now,
+		})
+	if result.Error != nil {
+		s.Logger.Info("ログインセッション更新失敗", zap.String("error", result.Error.Error()))
+		s.Logger.Info("トークン更新API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ログインセッションを更新できませんでした",
+		})
+	}
+	if result.RowsAffected != 1 {
+		s.Logger.Info("リフレッシュトークンが同時に利用されました", zap.String("sessionId", session.SessionId))
+		s.Logger.Info("トークン更新API終了")
+		return echo.ErrUnauthorized
+	}
+	s.Logger.Info("トークン更新API終了")
+	return s.tokenResponse(context, user, session.SessionId, refreshSecret)
+}
+
+// ログアウト（リクエストしたアクセストークンのセッションを失効させる）
+func (s *Server) PostLogout(context echo.Context) error {
+	s.Logger.Info("ログアウトAPI開始")
+	session := currentSession(context)
+	if err := s.revokeSessions(s.DB.Where("id = ?", session.Id)); err != nil {
+		s.Logger.Info("ログインセッション失効失敗", zap.String("error", err.Error()))
+		s.Logger.Info("ログアウトAPI終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "ログアウトできませんでした",
+		})
+	}
+	s.Logger.Info("ログアウトAPI終了", zap.String("sessionId", session.SessionId))
+	return context.NoContent(http.StatusNoContent)
+}
+
+// ログイン中のセッション一覧取得
+func (s *Server) GetSessions(context echo.Context) error {
+	current := currentSession(context)
+	var sessions []model.UserSession
+	s.DB.Where("mst_user_id = ? AND revoked_at IS NULL", current.MstUserId).Order("id").Find(&sessions)
+	active := []model.UserSession{}
+	for _, session := range sessions {
+		if session.Active(s.Clock()) {
+			session.Current = session.Id == current.Id
+			active = append(active, session)
+		}
+	}
+	return context.JSON(http.StatusOK, active)
+}
+
+// セッション失効（他の端末のログインを取り消す）
+func (s *Server) DeleteSession(context echo.Context) error {
+	s.Logger.Info("セッション失効API開始")
+	current := currentSession(context)
+	session := model.UserSession{}
+	s.DB.Where("session_id = ? AND mst_user_id = ?", context.Param("id"), current.MstUserId).Find(&session)
+	if session.Id == 0 {
+		s.Logger.Info("セッション失効API終了")
+		return context.JSON(http.StatusNotFound, map[string]interface{}{
+			"message": "セッションが見つかりません",
+		})
+	}
+	if err := s.revokeSessions(s.DB.Where("id = ?", session.Id)); err != nil {
+		s.Logger.Info("ログインセッション失効失敗", zap.String("error", err.Error()))
+		s.Logger.Info("セッション失効API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "セッションを失効できませんでした",
+		})
+	}
+	s.Logger.Info("セッション失効API終了", zap.String("sessionId", session.SessionId))
+	return context.NoContent(http.StatusNoContent)
+}
+
+// 条件に一致する有効なセッションを失効させる
+func (s *Server) revokeSessions(scope *gorm.DB) error {
+	return scope.Model(&model.UserSession{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", s.Clock()).Error
+}
+
+// 認証ミドルウェアが設定したセッション
+func currentSession(context echo.Context) model.UserSession {
+	return context.Get("session").(model.UserSession)
+}
+
+func newRefreshSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
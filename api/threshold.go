@@ -0,0 +1,222 @@
+package api
+
+import (
+	"face-recognition/auth"
+	"face-recognition/model"
+	"face-recognition/policy"
+	"github.com/labstack/echo"
+	"go.uber.org/zap"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+	"unicode/utf8"
+)
+
+// 判定しきい値の一覧（全体のデフォルトと設置場所ごとの設定）
+func (s *Server) GetThresholds(context echo.Context) error {
+	s.Logger.Info("しきい値一覧取得API開始")
+	locations := []model.LocationThreshold{}
+	s.DB.Order("location").Find(&locations)
+	s.Logger.Info("しきい値一覧取得API終了", zap.Int("件数", len(locations)))
+	return context.JSON(http.StatusOK, map[string]interface{}{
+		"default":   s.Policy.Default,
+		"locations": locations,
+	})
+}
+
+// 設置場所の判定しきい値の設定（なければ追加）
+func (s *Server) PutLocationThreshold(context echo.Context) error {
+	s.Logger.Info("設置場所しきい値設定API開始")
+	location := context.Param("location")
+	if utf8.RuneCountInString(location) > 64 {
+		s.Logger.Info("設置場所しきい値設定API終了")
+		return context.JSON(http.StatusBadRequest, []string{"設置場所は64文字以内で指定してください"})
+	}
+	thresholds, errorMessages := s.bindThresholds(context)
+	if errorMessages != nil {
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("設置場所しきい値設定API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	setting := model.LocationThreshold{}
+	s.DB.Where("location = ?", location).Find(&setting)
+	setting.Location = location
+	setting.AcceptThreshold = thresholds.Accept
+	setting.ReviewThreshold = thresholds.Review
+	if err := s.DB.Save(&setting).Error; err != nil {
+		s.Logger.Info("設置場所しきい値設定失敗", zap.String("error", err.Error()))
+		s.Logger.Info("設置場所しきい値設定API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "しきい値を設定できませんでした",
+		})
+	}
+	s.Logger.Info("設置場所しきい値設定API終了", zap.String("location", location))
+	return context.JSON(http.StatusOK, setting)
+}
+
+// 設置場所の判定しきい値の削除（全体のデフォルトに戻す）
+func (s *Server) DeleteLocationThreshold(context echo.Context) error {
+	s.Logger.Info("設置場所しきい値削除API開始")
+	location := context.Param("location")
+	result := s.DB.Where("location = ?", location).Delete(&model.LocationThreshold{})
+	if result.Error != nil {
+		s.Logger.Info("設置場所しきい値削除失敗", zap.String("error", result.Error.Error()))
+		s.Logger.Info("設置場所しきい値削除API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "しきい値を削除できませんでした",
+		})
+	}
+	if result.RowsAffected == 0 {
+		s.Logger.Info("設置場所しきい値削除API終了")
+		return context.JSON(http.StatusNotFound, map[string]interface{}{
+			"message": "設置場所のしきい値が設定されていません",
+		})
+	}
+	s.Logger.Info("設置場所しきい値削除API終了", zap.String("location", location))
+	return context.NoContent(http.StatusNoContent)
+}
+
+// ユーザの判定しきい値の個別設定
+func (s *Server) PutUserThreshold(context echo.Context) error {
+	s.Logger.Info("ユーザしきい値設定API開始")
+	user := model.MstUser{}
+	s.DB.Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		s.Logger.Info("ユーザしきい値設定API終了")
+		return userNotFound(context)
+	}
+	thresholds, errorMessages := s.bindThresholds(context)
+	if errorMessages != nil {
+		s.Logger.Info("パラメータエラー", zap.Strings("エラー内容", errorMessages))
+		s.Logger.Info("ユーザしきい値設定API終了")
+		return context.JSON(http.StatusBadRequest, errorMessages)
+	}
+	return s.updateUserThreshold(context, "ユーザしきい値設定API", user, map[string]interface{}{
+		"accept_threshold": thresholds.Accept,
+		"review_threshold": thresholds.Review,
+	})
+}
+
+// ユーザの判定しきい値の個別設定の削除（設置場所・全体の設定に戻す）
+func (s *Server) DeleteUserThreshold(context echo.Context) error {
+	s.Logger.Info("ユーザしきい値削除API開始")
+	user := model.MstUser{}
+	s.DB.Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		s.Logger.Info("ユーザしきい値削除API終了")
+		return userNotFound(context)
+	}
+	return s.updateUserThreshold(context, "ユーザしきい値削除API", user, map[string]interface{}{
+		"accept_threshold": nil,
+		"review_threshold": nil,
+	})
+}
+
+// ユーザの判定しきい値を更新する（apiは終了のログに出力するAPI名）
+func (s *Server) updateUserThreshold(context echo.Context, api string, user model.MstUser, updates map[string]interface{}) error {
+	if err := s.DB.Model(&user).Updates(updates).Error; err != nil {
+		s.Logger.Info("ユーザしきい値更新失敗", zap.String("error", err.Error()))
+		s.Logger.Info(api + "終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "しきい値を設定できませんでした",
+		})
+	}
+	s.Logger.Info(api+"終了", zap.Float64("userId", user.Id))
+	return s.userResponse(context, user.Id)
+}
+
+// 顔認証端末の設置場所の設定（端末の顔認証には設置場所の判定しきい値を適用する）
+func (s *Server) PutUserLocation(context echo.Context) error {
+	s.Logger.Info("端末設置場所設定API開始")
+	params := new(model.LocationParams)
+	if err := context.Bind(params); err != nil {
+		s.Logger.Info("端末設置場所設定API終了")
+		return context.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := validator.New().Struct(params); err != nil {
+		s.Logger.Info("パラメータエラー", zap.String("location", params.Location))
+		s.Logger.Info("端末設置場所設定API終了")
+		return context.JSON(http.StatusBadRequest, []string{"設置場所は64文字以内で指定してください"})
+	}
+	user := model.MstUser{}
+	s.DB.Where("id = ?", context.Param("id")).Find(&user)
+	if user.Id == 0 {
+		s.Logger.Info("端末設置場所設定API終了")
+		return userNotFound(context)
+	}
+	if auth.Role(user.Role) != auth.RoleKiosk {
+		s.Logger.Info("顔認証端末のユーザではありません", zap.Float64("userId", user.Id), zap.String("role", user.Role))
+		s.Logger.Info("端末設置場所設定API終了")
+		return context.JSON(http.StatusBadRequest, []string{"設置場所はkioskロールのユーザにのみ設定できます"})
+	}
+	if err := s.DB.Model(&user).Update("location", params.Location).Error; err != nil {
+		s.Logger.Info("端末設置場所設定失敗", zap.String("error", err.Error()))
+		s.Logger.Info("端末設置場所設定API終了")
+		return context.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"message": "設置場所を設定できませんでした",
+		})
+	}
+	s.Logger.Info("端末設置場所設定API終了", zap.Float64("userId", user.Id), zap.String("location", params.Location))
+	return s.userResponse(context, user.Id)
+}
+
+// 顔認証に使う設置場所（ログイン中の端末に設定した設置場所）
+// 端末が任意の設置場所のしきい値を選べないよう、リクエストの設置場所は端末の設定との照合にのみ使う
+func kioskLocation(context echo.Context, requested string) (string, bool) {
+	location := currentUser(context).Location
+	return location, requested == "" || requested == location
+}
+
+// しきい値のRequestBodyをバインドして検証する（エラーがあればメッセージを返す）
+func (s *Server) bindThresholds(context echo.Context) (policy.Thresholds, []string) {
+	params := new(model.ThresholdParams)
+	if err := context.Bind(params); err != nil {
+		return policy.Thresholds{}, []string{err.Error()}
+	}
+	validate := validator.New()
+	if err := validate.Struct(params); err != nil {
+		var errorMessages []string
+		for _, err := range err.(validator.ValidationErrors) {
+			switch err.Field() {
+			case "AcceptThreshold":
+				errorMessages = append(errorMessages, "本人と判定するしきい値は0〜100で指定してください")
+			case "ReviewThreshold":
+				errorMessages = append(errorMessages, "要確認のしきい値は0〜100で指定してください")
+			}
+		}
+		return policy.Thresholds{}, errorMessages
+	}
+	thresholds := policy.Thresholds{Accept: *params.AcceptThreshold, Review: *params.ReviewThreshold}
+	if err := thresholds.Validate(); err != nil {
+		return policy.Thresholds{}, []string{err.Error()}
+	}
+	return thresholds, nil
+}
+
+// 類似度を判定し、判定に使ったしきい値とあわせて顔認証結果に設定する
+func (s *Server) decide(result *model.FaceRecognitionResult, user model.MstUser, location string) policy.Decision {
+	decision := s.applyThresholds(result, user, location).Decide(result.Result)
+	result.Decision = string(decision)
+	return decision
+}
+
+// 適用するしきい値を決めて顔認証結果に設定する
+// しきい値はユーザ個別の設定 > 設置場所ごとの設定 > 全体のデフォルトの順に適用する
+func (s *Server) applyThresholds(result *model.FaceRecognitionResult, user model.MstUser, location string) policy.Thresholds {
+	var locationThresholds, userThresholds *policy.Thresholds
+	if location != "" {
+		setting := model.LocationThreshold{}
+		s.DB.Where("location = ?", location).Find(&setting)
+		if setting.Id != 0 {
+			locationThresholds = &policy.Thresholds{Accept: setting.AcceptThreshold, Review: setting.ReviewThreshold}
+		}
+	}
+	if user.AcceptThreshold != nil && user.ReviewThreshold != nil {
+		userThresholds = &policy.Thresholds{Accept: *user.AcceptThreshold, Review: *user.ReviewThreshold}
+	}
+	thresholds, scope := s.Policy.Resolve(locationThresholds, userThresholds)
+	result.Location = location
+	result.AcceptThreshold = thresholds.Accept
+	result.ReviewThreshold = thresholds.Review
+	result.ThresholdScope = string(scope)
+	return thresholds
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"time"
+)
+
+// JWTの署名鍵
+type Key struct {
+	// 鍵ID（JWTヘッダのkid）
+	Id     string
+	Secret []byte
+	// 検証に利用できる期限（ローテーション前の鍵のみ指定する。ゼロ値なら無期限）
+	ExpiresAt time.Time
+}
+
+// JWTの署名・検証に利用する鍵の集合
+// 署名は常に現在の鍵で行い、検証はkidに対応する鍵（ローテーション前の鍵を含む）で行う
+type Keyring struct {
+	current  Key
+	previous map[string]Key
+	// 現在時刻（ローテーション前の鍵の期限判定に利用する）
+	Now func() time.Time
+}
+
+func NewKeyring(current Key, previous ...Key) (*Keyring, error) {
+	if len(current.Secret) == 0 {
+		return nil, errors.New("署名鍵が指定されていません")
+	}
+	k := &Keyring{current: current, previous: map[string]Key{}, Now: time.Now}
+	for _, key := range previous {
+		if len(key.Secret) == 0 {
+			continue
+		}
+		if key.Id == current.Id {
+			return nil, fmt.Errorf("ローテーション前の鍵IDが現在の鍵IDと重複しています: %s", key.Id)
+		}
+		k.previous[key.Id] = key
+	}
+	return k, nil
+}
+
+// 現在の鍵で署名（ヘッダに鍵IDを付与する）
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if k.current.Id != "" {
+		token.Header["kid"] = k.current.Id
+	}
+	return token.SignedString(k.current.Secret)
+}
+
+// 署名を検証してクレームを取り出す
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, k.Keyfunc)
+}
+
+// 署名の検証に利用する鍵を返す（jwt.Keyfunc）
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	// HS256以外（noneなど）による改ざんを防ぐ
+	if token.Method != jwt.SigningMethodHS256 {
+		return nil, fmt.Errorf("未対応の署名方式です: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == k.current.Id {
+		return k.current.Secret, nil
+	}
+	key, ok := k.previous[kid]
+	if !ok {
+		return nil, fmt.Errorf("署名鍵が見つかりません: %s", kid)
+	}
+	if !key.ExpiresAt.IsZero() && k.Now().After(key.ExpiresAt) {
+		return nil, fmt.Errorf("署名鍵の検証期限を過ぎています: %s", kid)
+	}
+	return key.Secret, nil
+}
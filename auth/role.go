@@ -0,0 +1,84 @@
+package auth
+
+// ユーザのロール
+type Role string
+
+const (
+	// 管理者（すべての操作が可能）
+	RoleAdmin Role = "admin"
+	// 運用担当者（顔認証の実施・確認）
+	RoleOperator Role = "operator"
+	// 顔認証端末（QRトークンと顔写真による認証のみ）
+	RoleKiosk Role = "kiosk"
+	// 一般ユーザ（自身の情報の参照とQRトークンの発行）
+	RoleMember Role = "member"
+)
+
+// 操作の権限
+type Permission string
+
+const (
+	// 自身のユーザ情報の参照
+	PermissionUserRead Permission = "user:read"
+	// 全ユーザの参照
+	PermissionUserReadAll Permission = "user:read_all"
+	// ユーザの管理（更新・停止・削除・ロールの変更）
+	PermissionUserManage Permission = "user:manage"
+	// QRトークンの発行
+	PermissionQrTokenIssue Permission = "qr_token:issue"
+	// 顔認証の実施
+	PermissionFaceRecognize Permission = "face:recognize"
+	// 自身のログインセッションの管理
+	PermissionSessionManage Permission = "session:manage"
+	// 自身のユーザ情報の参照・更新
+	PermissionProfile Permission = "profile"
+	// 顔照合結果の判定しきい値の管理
+	PermissionThresholdManage Permission = "threshold:manage"
+)
+
+// ロールごとの権限
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermissionUserRead,
+		PermissionUserReadAll,
+		PermissionUserManage,
+		PermissionQrTokenIssue,
+		PermissionFaceRecognize,
+		PermissionSessionManage,
+		PermissionProfile,
+		PermissionThresholdManage,
+	},
+	RoleOperator: {
+		PermissionUserRead,
+		PermissionFaceRecognize,
+		PermissionSessionManage,
+		PermissionProfile,
+	},
+	RoleKiosk: {
+		PermissionFaceRecognize,
+		PermissionSessionManage,
+		PermissionProfile,
+	},
+	RoleMember: {
+		PermissionUserRead,
+		PermissionQrTokenIssue,
+		PermissionSessionManage,
+		PermissionProfile,
+	},
+}
+
+// 定義済みのロールか
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// 権限を持っているか（未定義のロールは何の権限も持たない）
+func (r Role) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -1,44 +1,45 @@
 package aws
 
 import (
-	"face-recognition/config"
+	"errors"
 	"face-recognition/logger"
-	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/rekognition"
 	"go.uber.org/zap"
 	"strconv"
 )
 
+// 比較する画像に顔が写っていない
+var ErrNoFace = errors.New("画像に顔が写っていません")
+
+// S3上の画像を指定するRekognitionの画像パラメータ
+func (c *Client) S3Image(s3Key string) *rekognition.Image {
+	return &rekognition.Image{
+		S3Object: &rekognition.S3Object{
+			Bucket: aws.String(c.bucket),
+			Name:   aws.String(s3Key),
+		},
+	}
+}
+
+// 画像データを直接渡すRekognitionの画像パラメータ
+func BytesImage(data []byte) *rekognition.Image {
+	return &rekognition.Image{
+		Bytes: data,
+	}
+}
+
 // AWS Rekognition顔認証（比較）
-func CompareFaces(sourceImageS3Key string, targetImageS3Key string) (similarity float64, err error) {
-	// セッション作成
-	cred := credentials.NewStaticCredentials(config.Config.AccessKeyId, config.Config.SecretAccessKey, "")
-	sess := session.Must(session.NewSession(&aws.Config{
-		Credentials: cred,
-		Region: aws.String(config.Config.Region),
-	}))
+func (c *Client) CompareFaces(sourceImage *rekognition.Image, targetImage *rekognition.Image) (similarity float64, err error) {
 	// 解析オブジェクト作成
-	svc := rekognition.New(sess)
+	svc := rekognition.New(c.sess)
 	// パラメータセット
 	input := &rekognition.CompareFacesInput{
-		// 認識度（高いほど厳しい：0-100）
-		SimilarityThreshold: aws.Float64(90.000000),
-		SourceImage: &rekognition.Image{
-			S3Object: &rekognition.S3Object{
-				Bucket: aws.String(config.Config.Bucket),
-				Name: aws.String(sourceImageS3Key),
-			},
-		},
-		TargetImage: &rekognition.Image{
-			S3Object: &rekognition.S3Object{
-				Bucket: aws.String(config.Config.Bucket),
-				Name: aws.String(targetImageS3Key),
-			},
-		},
+		// 本人かどうかは呼び出し側のしきい値で判定するため、類似度によらず結果を返させる
+		SimilarityThreshold: aws.Float64(0),
+		SourceImage:         sourceImage,
+		TargetImage:         targetImage,
 	}
 	// 顔比較実行
 	response, err := svc.CompareFaces(input)
@@ -49,7 +50,7 @@ func CompareFaces(sourceImageS3Key string, targetImageS3Key string) (similarity
 			// 顔が写っていないエラー
 			case rekognition.ErrCodeInvalidParameterException:
 				logger.Log.Info("判定画像に顔が写っていない")
-				return 0, nil
+				return 0, ErrNoFace
 			default:
 				logger.Log.Info(err.Error())
 				return 0, err
@@ -57,15 +58,84 @@ func CompareFaces(sourceImageS3Key string, targetImageS3Key string) (similarity
 		}
 		return 0, err
 	}
-	fmt.Println("認証結果：", response)
-	logger.Log.Info(response.String())
+	logger.Log.Debug("rekognitionのCompareFaces結果", zap.String("response", response.String()))
 	// 認証結果判定
 	if len(response.FaceMatches) != 0 {
 		ret := *response.FaceMatches[0].Similarity
-		logger.Log.Info("顔認証結果OK", zap.String("認識度", strconv.FormatFloat(ret, 'f', 2, 64)))
+		logger.Log.Info("顔比較結果", zap.String("認識度", strconv.FormatFloat(ret, 'f', 2, 64)))
 		return ret, nil
 	} else {
-		logger.Log.Info("顔認証結果NG")
+		logger.Log.Info("比較できる顔がない")
 		return 0, nil
 	}
-}
\ No newline at end of file
+}
+
+// AWS Rekognition顔検出
+func (c *Client) DetectFaces(image *rekognition.Image) ([]*rekognition.FaceDetail, error) {
+	svc := rekognition.New(c.sess)
+	response, err := svc.DetectFaces(&rekognition.DetectFacesInput{
+		// 品質判定に利用するため全属性を取得
+		Attributes: []*string{aws.String(rekognition.AttributeAll)},
+		Image:      image,
+	})
+	if err != nil {
+		logger.Log.Info("rekognitionのDetectFacesエラー", zap.String("error", err.Error()))
+		return nil, err
+	}
+	return response.FaceDetails, nil
+}
+
+// AWS Rekognitionコレクションへの顔登録
+func (c *Client) IndexFaces(externalImageId string, image *rekognition.Image) (faceId string, err error) {
+	svc := rekognition.New(c.sess)
+	response, err := svc.IndexFaces(&rekognition.IndexFacesInput{
+		CollectionId:    aws.String(c.collectionId),
+		ExternalImageId: aws.String(externalImageId),
+		// 登録するのは画像内で最も大きな顔のみ
+		MaxFaces: aws.Int64(1),
+		Image:    image,
+	})
+	if err != nil {
+		logger.Log.Info("rekognitionのIndexFacesエラー", zap.String("error", err.Error()))
+		return "", err
+	}
+	if len(response.FaceRecords) == 0 {
+		logger.Log.Info("登録対象の顔が検出されなかった", zap.String("externalImageId", externalImageId))
+		return "", nil
+	}
+	return *response.FaceRecords[0].Face.FaceId, nil
+}
+
+// AWS Rekognitionコレクションの顔検索（類似度の高い順）
+func (c *Client) SearchFacesByImage(image *rekognition.Image, maxFaces int64) ([]*rekognition.FaceMatch, error) {
+	svc := rekognition.New(c.sess)
+	response, err := svc.SearchFacesByImage(&rekognition.SearchFacesByImageInput{
+		CollectionId: aws.String(c.collectionId),
+		// 本人かどうかは呼び出し側のしきい値で判定するため、類似度によらず候補を返させる
+		FaceMatchThreshold: aws.Float64(0),
+		MaxFaces:           aws.Int64(maxFaces),
+		Image:              image,
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == rekognition.ErrCodeInvalidParameterException {
+			logger.Log.Info("検索画像に顔が写っていない")
+			return nil, nil
+		}
+		logger.Log.Info("rekognitionのSearchFacesByImageエラー", zap.String("error", err.Error()))
+		return nil, err
+	}
+	return response.FaceMatches, nil
+}
+
+// AWS Rekognitionコレクションからの顔削除
+func (c *Client) DeleteFaces(faceIds []string) error {
+	svc := rekognition.New(c.sess)
+	_, err := svc.DeleteFaces(&rekognition.DeleteFacesInput{
+		CollectionId: aws.String(c.collectionId),
+		FaceIds:      aws.StringSlice(faceIds),
+	})
+	if err != nil {
+		logger.Log.Info("rekognitionのDeleteFacesエラー", zap.String("error", err.Error()))
+	}
+	return err
+}
@@ -2,74 +2,75 @@ package aws
 
 import (
 	"bytes"
-	"encoding/base64"
 	"errors"
-	"face-recognition/config"
 	"face-recognition/logger"
-	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"go.uber.org/zap"
+	"time"
 )
 
-type ImageUploadToS3 struct {
-	Region          string
-	BucketName      string
-	AccessKeyId     string
-	SecretAccessKey string
-}
+// S3上にオブジェクトが存在しない
+var ErrNoSuchKey = errors.New("S3上に画像が存在しません")
 
 // AWS S3へアップロード
-func PutToS3(imageBase64 string, fileName string, extension string) (url string, err error) {
-	// アップロードファイル名、写真（base64形式）チェック
-	if fileName == "" {
-		return "", errors.New("ファイルは必須項目です")
-	} else if imageBase64 == "" {
-		return "", errors.New("写真は必須項目です")
-	}
-	// Content-Typeの設定
-	var contentType string
-	switch extension {
-	case "jpg":
-		contentType = "image/jpeg"
-	case "jpeg":
-		contentType = "image/jpeg"
-	case "png":
-		contentType = "image/png"
-	default:
-		return "", errors.New("拡張子が無効です")
-	}
-
-	// セッション作成
-	cred := credentials.NewStaticCredentials(config.Config.AccessKeyId, config.Config.SecretAccessKey, "")
-	sess := session.Must(session.NewSession(&aws.Config{
-		Credentials: cred,
-		Region: aws.String(config.Config.Region),
-	}))
-
-	// base64から画像生成（バッファに書き込む）
-	data, err := base64.StdEncoding.DecodeString(imageBase64)
-	if err != nil {
-		logger.Log.Info("base64から画像生成エラー", zap.String("写真", imageBase64))
-		return "", err
-	}
-	wb := new(bytes.Buffer)
-	wb.Write(data)
-
+func (c *Client) PutObject(key string, data []byte, contentType string) (url string, err error) {
 	// Uploaderを作成
-	uploader := s3manager.NewUploader(sess)
+	uploader := s3manager.NewUploader(c.sess)
 	resp, err := uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(config.Config.Bucket),
-		Key:    aws.String(fileName),
+		Bucket:      aws.String(c.bucket),
+		Key:         aws.String(key),
 		ContentType: aws.String(contentType),
-		Body:   wb,
+		Body:        bytes.NewReader(data),
 	})
 	if err != nil {
-		logger.Log.Info("S3画像アップロードエラー", zap.String("ファイル", fileName))
+		logger.Log.Info("S3画像アップロードエラー", zap.String("ファイル", key))
 		return "", err
 	}
-	fmt.Println("結果：", resp.Location)
+	logger.Log.Debug("S3画像アップロード", zap.String("location", resp.Location))
 	return resp.Location, nil
-}
\ No newline at end of file
+}
+
+// AWS S3からダウンロード
+func (c *Client) GetObject(key string) ([]byte, error) {
+	downloader := s3manager.NewDownloader(c.sess)
+	buf := aws.NewWriteAtBuffer([]byte{})
+	_, err := downloader.Download(buf, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrNoSuchKey
+		}
+		logger.Log.Info("S3画像ダウンロードエラー", zap.String("ファイル", key))
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// AWS S3から削除
+func (c *Client) DeleteObject(key string) error {
+	svc := s3.New(c.sess)
+	_, err := svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		logger.Log.Info("S3画像削除エラー", zap.String("ファイル", key))
+		return err
+	}
+	return nil
+}
+
+// 期限付きで参照できる署名付きURLを発行
+func (c *Client) PresignGetObject(key string, expires time.Duration) (string, error) {
+	svc := s3.New(c.sess)
+	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(expires)
+}
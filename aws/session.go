@@ -0,0 +1,39 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// AWS接続設定
+type Config struct {
+	Region          string
+	AccessKeyId     string
+	SecretAccessKey string
+	Bucket          string
+	// Rekognitionの顔コレクションID
+	CollectionId string
+}
+
+// AWSクライアント（S3・Rekognitionで共有する）
+type Client struct {
+	sess         *session.Session
+	bucket       string
+	collectionId string
+}
+
+// AWSクライアント生成
+func NewClient(cfg Config) *Client {
+	// セッション作成
+	cred := credentials.NewStaticCredentials(cfg.AccessKeyId, cfg.SecretAccessKey, "")
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: cred,
+		Region:      aws.String(cfg.Region),
+	}))
+	return &Client{
+		sess:         sess,
+		bucket:       cfg.Bucket,
+		collectionId: cfg.CollectionId,
+	}
+}
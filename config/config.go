@@ -1,71 +1,448 @@
 package config
 
 import (
+	"face-recognition/policy"
+	"flag"
 	"fmt"
-	"github.com/labstack/gommon/log"
 	"gopkg.in/ini.v1"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ConfigList struct {
-	DbDriverName    string
-	DbName          string
-	DbUserName      string
-	DbUserPassword  string
-	DbHost          string
-	DbPort          string
-	Secret          string
+	// 実行環境名（config.iniのDB接続情報のセクション名）
+	Env            string
+	DbDriverName   string
+	DbName         string
+	DbUserName     string
+	DbUserPassword string
+	DbHost         string
+	DbPort         string
+	// コネクションプール設定
+	DbMaxOpenConns    int
+	DbMaxIdleConns    int
+	DbConnMaxLifetime time.Duration
+	// 画像URLの署名などに利用するアプリケーション共通の秘密鍵
+	Secret string
+	// セッション（ログイン）用JWTの署名鍵とローテーション前の鍵
+	SessionKeyId                string
+	SessionKey                  string
+	SessionPreviousKeyId        string
+	SessionPreviousKey          string
+	SessionPreviousKeyExpiresAt time.Time
+	// QRトークン用JWTの署名鍵とローテーション前の鍵
+	QrKeyId                string
+	QrKey                  string
+	QrPreviousKeyId        string
+	QrPreviousKey          string
+	QrPreviousKeyExpiresAt time.Time
+	// アクセストークン・リフレッシュトークン（ログインセッション）の有効期限
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
 	LoggerFilePath  string
 	LoggerLevel     string
-	Region          string
-	Bucket          string
-	AccessKeyId     string
-	SecretAccessKey string
+	// リクエストボディのログ出力設定
+	LogRequestBody              bool
+	LogRequestBodyMaxBytes      int
+	LogRequestBodyRedactFields  []string
+	LogRequestBodyExcludeRoutes []string
+	Region                      string
+	Bucket                      string
+	AccessKeyId                 string
+	SecretAccessKey             string
+	CollectionId                string
+	FaceMatcher                 string
+	FakeFixturePath             string
+	StorageBackend              string
+	StorageLocalDir             string
+	StorageBaseURL              string
+	// 顔照合結果の判定しきい値（全体のデフォルト）
+	FaceAcceptThreshold float64
+	FaceReviewThreshold float64
+	// 顔認証にライブネスチャレンジを必須とするか・チャレンジの有効期限
+	LivenessRequired     bool
+	LivenessChallengeTTL time.Duration
+	// なりすまし検知バックエンドと、認証を拒否するスコア
+	SpoofDetector  string
+	SpoofThreshold float64
+	// QRトークンの有効期限とローテーションの間隔
+	QrTokenTTL              time.Duration
+	QrTokenRotationInterval time.Duration
+	// QRトークン1つで顔認証に成功できる回数（0は無制限）
+	QrTokenMaxUses int
+	// QRコード画像のデフォルトの大きさ（ピクセル）と誤り訂正レベル
+	QrImageSize          int
+	QrImageRecoveryLevel string
+	// 起動は続けられる設定の不備（ロガーの初期化後にmainで出力する）
+	Warnings []string
 }
 
-var Config ConfigList
-
-func init()  {
-	cfg, err := ini.Load("config.ini")
-	if err != nil {
-		log.Printf("Failed to read file: %v", err)
-		os.Exit(1)
-	}
-	// 実行環境取得
-	goEnv := cfg.Section("env").Key("go_env").MustString("development")
-	fmt.Println("実行環境：", goEnv)
-	// 環境変数設定
-	if goEnv == "development" {
-		Config = ConfigList{
-			DbDriverName:    cfg.Section("dev").Key("db_driver_name").String(),
-			DbName:          cfg.Section("dev").Key("db_name").String(),
-			DbUserName:      cfg.Section("dev").Key("db_user_name").String(),
-			DbUserPassword:  cfg.Section("dev").Key("db_user_password").String(),
-			DbHost:          cfg.Section("dev").Key("db_host").String(),
-			DbPort:          cfg.Section("dev").Key("db_port").String(),
-			Secret:          cfg.Section("key").Key("secret").String(),
-			LoggerFilePath:  cfg.Section("log").Key("logger_file_path").String(),
-			LoggerLevel:     cfg.Section("log").Key("logger_level").MustString("info"),
-			Region:          cfg.Section("aws").Key("region").String(),
-			Bucket:          cfg.Section("aws").Key("bucket").String(),
-			AccessKeyId:     cfg.Section("aws").Key("access_key_id").String(),
-			SecretAccessKey: cfg.Section("aws").Key("secret_access_key").String(),
-		}
-	} else {
-		Config = ConfigList{
-			DbDriverName:    cfg.Section("prd").Key("db_driver_name").String(),
-			DbName:          cfg.Section("prd").Key("db_name").String(),
-			DbUserName:      cfg.Section("prd").Key("db_user_name").String(),
-			DbUserPassword:  cfg.Section("prd").Key("db_user_password").String(),
-			DbHost:          cfg.Section("prd").Key("db_host").String(),
-			DbPort:          cfg.Section("prd").Key("db_port").String(),
-			Secret:          cfg.Section("key").Key("secret").String(),
-			LoggerFilePath:  cfg.Section("log").Key("logger_file_path").String(),
-			LoggerLevel:     cfg.Section("log").Key("logger_level").MustString("info"),
-			Region:          cfg.Section("aws").Key("region").String(),
-			Bucket:          cfg.Section("aws").Key("bucket").String(),
-			AccessKeyId:     cfg.Section("aws").Key("access_key_id").String(),
-			SecretAccessKey: cfg.Section("aws").Key("secret_access_key").String(),
+// 実行環境ごとのセクション（[dev]、[prd]など）を表す
+const envSection = ""
+
+// 設定項目の定義
+// 値はデフォルト値 < config.ini < 環境変数 < コマンドライン引数の順に上書きする
+// コマンドライン引数名は環境変数名からFACE_を除いて小文字・ハイフン区切りにしたもの（FACE_DB_HOST → -db-host）
+type field struct {
+	section string
+	key     string
+	env     string
+	def     string
+	// 値を"file:<パス>"形式でファイルから読み込めるか（秘密鍵など）
+	file bool
+	// 設定先（*string、*int、*float64、*bool、*[]string（カンマ区切り）、*time.Duration、*time.Timeのいずれか）
+	target interface{}
+}
+
+func (c *ConfigList) fields() []field {
+	return []field{
+		{section: envSection, key: "db_driver_name", env: "FACE_DB_DRIVER_NAME", def: "mysql", target: &c.DbDriverName},
+		{section: envSection, key: "db_name", env: "FACE_DB_NAME", def: "face", target: &c.DbName},
+		{section: envSection, key: "db_user_name", env: "FACE_DB_USER_NAME", target: &c.DbUserName},
+		{section: envSection, key: "db_user_password", env: "FACE_DB_USER_PASSWORD", target: &c.DbUserPassword},
+		{section: envSection, key: "db_host", env: "FACE_DB_HOST", def: "127.0.0.1", target: &c.DbHost},
+		{section: envSection, key: "db_port", env: "FACE_DB_PORT", def: "3306", target: &c.DbPort},
+		{section: envSection, key: "db_max_open_conns", env: "FACE_DB_MAX_OPEN_CONNS", def: "25", target: &c.DbMaxOpenConns},
+		{section: envSection, key: "db_max_idle_conns", env: "FACE_DB_MAX_IDLE_CONNS", def: "25", target: &c.DbMaxIdleConns},
+		{section: envSection, key: "db_conn_max_lifetime", env: "FACE_DB_CONN_MAX_LIFETIME", def: "5m", target: &c.DbConnMaxLifetime},
+		{section: "key", key: "secret", env: "FACE_SECRET", file: true, target: &c.Secret},
+		{section: "key", key: "session_key_id", env: "FACE_SESSION_KEY_ID", target: &c.SessionKeyId},
+		{section: "key", key: "session_key", env: "FACE_SESSION_KEY", file: true, target: &c.SessionKey},
+		{section: "key", key: "session_previous_key_id", env: "FACE_SESSION_PREVIOUS_KEY_ID", target: &c.SessionPreviousKeyId},
+		{section: "key", key: "session_previous_key", env: "FACE_SESSION_PREVIOUS_KEY", file: true, target: &c.SessionPreviousKey},
+		{section: "key", key: "session_previous_key_expires_at", env: "FACE_SESSION_PREVIOUS_KEY_EXPIRES_AT", target: &c.SessionPreviousKeyExpiresAt},
+		{section: "key", key: "qr_key_id", env: "FACE_QR_KEY_ID", target: &c.QrKeyId},
+		{section: "key", key: "qr_key", env: "FACE_QR_KEY", file: true, target: &c.QrKey},
+		{section: "key", key: "qr_previous_key_id", env: "FACE_QR_PREVIOUS_KEY_ID", target: &c.QrPreviousKeyId},
+		{section: "key", key: "qr_previous_key", env: "FACE_QR_PREVIOUS_KEY", file: true, target: &c.QrPreviousKey},
+		{section: "key", key: "qr_previous_key_expires_at", env: "FACE_QR_PREVIOUS_KEY_EXPIRES_AT", target: &c.QrPreviousKeyExpiresAt},
+		{section: "session", key: "access_token_ttl", env: "FACE_ACCESS_TOKEN_TTL", def: "15m", target: &c.AccessTokenTTL},
+		{section: "session", key: "refresh_token_ttl", env: "FACE_REFRESH_TOKEN_TTL", def: "720h", target: &c.RefreshTokenTTL},
+		{section: "qr", key: "token_ttl", env: "FACE_QR_TOKEN_TTL", def: "5m", target: &c.QrTokenTTL},
+		{section: "qr", key: "rotation_interval", env: "FACE_QR_ROTATION_INTERVAL", def: "1m", target: &c.QrTokenRotationInterval},
+		{section: "qr", key: "max_uses", env: "FACE_QR_MAX_USES", def: "1", target: &c.QrTokenMaxUses},
+		{section: "qr", key: "image_size", env: "FACE_QR_IMAGE_SIZE", def: "256", target: &c.QrImageSize},
+		{section: "qr", key: "image_recovery_level", env: "FACE_QR_IMAGE_RECOVERY_LEVEL", def: "medium", target: &c.QrImageRecoveryLevel},
+		{section: "log", key: "logger_file_path", env: "FACE_LOGGER_FILE_PATH", target: &c.LoggerFilePath},
+		{section: "log", key: "logger_level", env: "FACE_LOGGER_LEVEL", def: "info", target: &c.LoggerLevel},
+		{section: "log", key: "request_body", env: "FACE_LOG_REQUEST_BODY", def: "true", target: &c.LogRequestBody},
+		{section: "log", key: "request_body_max_bytes", env: "FACE_LOG_REQUEST_BODY_MAX_BYTES", def: "1024", target: &c.LogRequestBodyMaxBytes},
+		{section: "log", key: "request_body_redact_fields", env: "FACE_LOG_REQUEST_BODY_REDACT_FIELDS", def: "password,photo,frames,qrToken,refreshToken", target: &c.LogRequestBodyRedactFields},
+		{section: "log", key: "request_body_exclude_routes", env: "FACE_LOG_REQUEST_BODY_EXCLUDE_ROUTES", target: &c.LogRequestBodyExcludeRoutes},
+		{section: "aws", key: "region", env: "FACE_AWS_REGION", target: &c.Region},
+		{section: "aws", key: "bucket", env: "FACE_AWS_BUCKET", target: &c.Bucket},
+		{section: "aws", key: "access_key_id", env: "FACE_AWS_ACCESS_KEY_ID", target: &c.AccessKeyId},
+		{section: "aws", key: "secret_access_key", env: "FACE_AWS_SECRET_ACCESS_KEY", target: &c.SecretAccessKey},
+		{section: "aws", key: "collection_id", env: "FACE_AWS_COLLECTION_ID", target: &c.CollectionId},
+		{section: "face", key: "matcher", env: "FACE_MATCHER", def: "rekognition", target: &c.FaceMatcher},
+		{section: "face", key: "fake_fixture_path", env: "FACE_FAKE_FIXTURE_PATH", target: &c.FakeFixturePath},
+		{section: "face", key: "accept_threshold", env: "FACE_ACCEPT_THRESHOLD", def: "90", target: &c.FaceAcceptThreshold},
+		{section: "face", key: "review_threshold", env: "FACE_REVIEW_THRESHOLD", def: "80", target: &c.FaceReviewThreshold},
+		{section: "face", key: "liveness_required", env: "FACE_LIVENESS_REQUIRED", def: "true", target: &c.LivenessRequired},
+		{section: "face", key: "spoof_detector", env: "FACE_SPOOF_DETECTOR", def: "none", target: &c.SpoofDetector},
+		{section: "face", key: "spoof_threshold", env: "FACE_SPOOF_THRESHOLD", def: "50", target: &c.SpoofThreshold},
+		{section: "face", key: "liveness_challenge_ttl", env: "FACE_LIVENESS_CHALLENGE_TTL", def: "1m", target: &c.LivenessChallengeTTL},
+		{section: "storage", key: "backend", env: "FACE_STORAGE_BACKEND", def: "s3", target: &c.StorageBackend},
+		{section: "storage", key: "local_dir", env: "FACE_STORAGE_LOCAL_DIR", target: &c.StorageLocalDir},
+		{section: "storage", key: "base_url", env: "FACE_STORAGE_BASE_URL", target: &c.StorageBaseURL},
+	}
+}
+
+func (f field) flagName() string {
+	return strings.ToLower(strings.Replace(strings.TrimPrefix(f.env, "FACE_"), "_", "-", -1))
+}
+
+// 設定値の不備（すべての問題をまとめて報告する）
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "設定値が不正です:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// 設定読み込み（起動時にmainから呼び出す）
+// argsはコマンドライン引数で、フラグ以降の引数（サブコマンドなど）を返す
+func Load(args []string) (*ConfigList, []string, error) {
+	return load(args, os.LookupEnv)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool)) (*ConfigList, []string, error) {
+	c := &ConfigList{}
+	fields := c.fields()
+
+	// コマンドライン引数
+	fs := flag.NewFlagSet("face-recognition", flag.ContinueOnError)
+	configPath := fs.String("config", "", "設定ファイルのパス（環境変数FACE_CONFIG、デフォルトはconfig.ini）")
+	env := fs.String("env", "", "実行環境名（環境変数FACE_ENV、config.iniの[env] go_env）")
+	flagValues := make([]*string, len(fields))
+	for i, f := range fields {
+		flagValues[i] = fs.String(f.flagName(), "", fmt.Sprintf("config.iniの[%s] %s（環境変数%s）", sectionLabel(f.section), f.key, f.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	flagSet := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { flagSet[f.Name] = true })
+
+	// 設定ファイル（明示的に指定した場合のみ、存在しなければエラー）
+	path, explicit := "config.ini", false
+	if v, ok := lookupEnv("FACE_CONFIG"); ok {
+		path, explicit = v, true
+	}
+	if flagSet["config"] {
+		path, explicit = *configPath, true
+	}
+	file, fileLoaded := ini.Empty(), false
+	if _, err := os.Stat(path); err == nil || explicit {
+		loaded, err := ini.Load(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("設定ファイルを読み込めません: %v", err)
+		}
+		file, fileLoaded = loaded, true
+	}
+
+	// 実行環境
+	c.Env = file.Section("env").Key("go_env").MustString("dev")
+	if v, ok := lookupEnv("FACE_ENV"); ok {
+		c.Env = v
+	}
+	if flagSet["env"] {
+		c.Env = *env
+	}
+	var problems []string
+	if c.Env == "" {
+		problems = append(problems, "FACE_ENV: 実行環境名は必須です")
+	} else if _, err := file.GetSection(c.Env); fileLoaded && err != nil {
+		// DB接続情報をすべて環境変数で渡す構成もあるため、エラーにはしない
+		c.Warnings = append(c.Warnings, fmt.Sprintf("FACE_ENV: 設定ファイルに実行環境のセクションがありません（%s）", c.Env))
+	}
+	for i, f := range fields {
+		value := f.def
+		section := f.section
+		if section == envSection {
+			section = c.Env
+		}
+		if file.Section(section).HasKey(f.key) {
+			value = file.Section(section).Key(f.key).String()
+		}
+		if v, ok := lookupEnv(f.env); ok {
+			value = v
+		}
+		if flagSet[f.flagName()] {
+			value = *flagValues[i]
+		}
+		value = strings.TrimSpace(value)
+		if f.file && strings.HasPrefix(value, "file:") {
+			data, err := ioutil.ReadFile(strings.TrimPrefix(value, "file:"))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: ファイルを読み込めません（%v）", f.env, err))
+				continue
+			}
+			value = strings.TrimSpace(string(data))
+		}
+		if err := assign(f.target, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.env, err))
+		}
+	}
+	command := ""
+	if fs.NArg() > 0 {
+		command = fs.Arg(0)
+	}
+	problems = append(problems, c.validate(command)...)
+	if len(problems) > 0 {
+		return nil, nil, &ValidationError{Problems: problems}
+	}
+	return c, fs.Args(), nil
+}
+
+func assign(target interface{}, value string) error {
+	switch t := target.(type) {
+	case *string:
+		*t = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("数値ではありません（%s）", value)
+		}
+		*t = n
+	case *float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("数値ではありません（%s）", value)
+		}
+		*t = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("真偽値ではありません（%s）", value)
+		}
+		*t = b
+	case *[]string:
+		*t = nil
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*t = append(*t, v)
+			}
+		}
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("期間の形式ではありません（%s）", value)
+		}
+		*t = d
+	case *time.Time:
+		if value == "" {
+			*t = time.Time{}
+			return nil
+		}
+		tm, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("日時の形式（RFC3339）ではありません（%s）", value)
 		}
+		*t = tm
+	}
+	return nil
+}
+
+// 必須項目・設定値の組み合わせの検証（commandはサブコマンド名で、利用する設定のみ検証する）
+func (c *ConfigList) validate(command string) []string {
+	problems := append(c.validateDb(), c.validateLog()...)
+	// マイグレーションはDB接続とログ出力の設定のみ利用する
+	if command == "migrate" {
+		return problems
+	}
+	return append(problems, c.validateServer()...)
+}
+
+// DB接続の設定の検証
+func (c *ConfigList) validateDb() []string {
+	var problems []string
+	if c.DbMaxOpenConns < 1 {
+		problems = append(problems, "FACE_DB_MAX_OPEN_CONNS: 1以上を指定してください")
+	}
+	if c.DbMaxIdleConns < 0 {
+		problems = append(problems, "FACE_DB_MAX_IDLE_CONNS: 0以上を指定してください")
+	}
+	return problems
+}
+
+// ログ出力の設定の検証
+func (c *ConfigList) validateLog() []string {
+	var problems []string
+	switch c.LoggerLevel {
+	case "debug", "info", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("FACE_LOGGER_LEVEL: 未対応のログレベルです（%s）", c.LoggerLevel))
+	}
+	if c.LogRequestBodyMaxBytes < 0 {
+		problems = append(problems, "FACE_LOG_REQUEST_BODY_MAX_BYTES: 0以上を指定してください")
+	}
+	for _, route := range c.LogRequestBodyExcludeRoutes {
+		// "POST /api/v1/users/register"の形式
+		if parts := strings.Fields(route); len(parts) != 2 || !strings.HasPrefix(parts[1], "/") {
+			problems = append(problems, fmt.Sprintf("FACE_LOG_REQUEST_BODY_EXCLUDE_ROUTES: \"メソッド パス\"の形式で指定してください（%s）", route))
+		}
+	}
+	return problems
+}
+
+// サーバ・顔検索の索引登録で利用する設定（署名鍵・AWS・顔照合・画像ストレージなど）の検証
+func (c *ConfigList) validateServer() []string {
+	var problems []string
+	// セッション用とQRトークン用で同じ鍵を使うと、QRトークンでAPIにログインできてしまう
+	if c.SessionKey == "" {
+		problems = append(problems, "FACE_SESSION_KEY: セッション用JWTの署名鍵は必須です")
+	}
+	if c.QrKey == "" {
+		problems = append(problems, "FACE_QR_KEY: QRトークン用JWTの署名鍵は必須です")
+	}
+	if c.SessionKey != "" && c.SessionKey == c.QrKey {
+		problems = append(problems, "FACE_QR_KEY: セッション用と異なる署名鍵を指定してください")
+	}
+	if c.SessionPreviousKey != "" && c.SessionPreviousKeyId == c.SessionKeyId {
+		problems = append(problems, "FACE_SESSION_PREVIOUS_KEY_ID: 現在の鍵IDと異なる鍵IDを指定してください")
+	}
+	if c.QrPreviousKey != "" && c.QrPreviousKeyId == c.QrKeyId {
+		problems = append(problems, "FACE_QR_PREVIOUS_KEY_ID: 現在の鍵IDと異なる鍵IDを指定してください")
+	}
+	// AWSを利用する構成の場合のみリージョン・バケットを必須とする
+	if c.FaceMatcher == "rekognition" || c.StorageBackend == "s3" {
+		if c.Region == "" {
+			problems = append(problems, "FACE_AWS_REGION: AWSのリージョンは必須です")
+		}
+	}
+	if c.StorageBackend == "s3" && c.Bucket == "" {
+		problems = append(problems, "FACE_AWS_BUCKET: S3のバケットは必須です")
+	}
+	// 顔写真の登録時にコレクションへ顔を登録する
+	if c.FaceMatcher == "rekognition" && c.CollectionId == "" {
+		problems = append(problems, "FACE_AWS_COLLECTION_ID: Rekognitionのコレクションは必須です")
+	}
+	switch c.FaceMatcher {
+	case "rekognition", "fake":
+	default:
+		problems = append(problems, fmt.Sprintf("FACE_MATCHER: 未対応の顔照合バックエンドです（%s）", c.FaceMatcher))
+	}
+	switch c.StorageBackend {
+	case "s3", "memory":
+	case "local":
+		if c.StorageLocalDir == "" {
+			problems = append(problems, "FACE_STORAGE_LOCAL_DIR: 画像の保存先ディレクトリは必須です")
+		}
+		if c.Secret == "" {
+			problems = append(problems, "FACE_SECRET: 画像URLの署名鍵は必須です")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("FACE_STORAGE_BACKEND: 未対応の画像ストレージです（%s）", c.StorageBackend))
+	}
+	if c.AccessTokenTTL <= 0 {
+		problems = append(problems, "FACE_ACCESS_TOKEN_TTL: 0より大きい期間を指定してください")
+	}
+	if c.RefreshTokenTTL < c.AccessTokenTTL {
+		problems = append(problems, "FACE_REFRESH_TOKEN_TTL: アクセストークンの有効期限以上の期間を指定してください")
+	}
+	switch c.SpoofDetector {
+	case "none", "heuristic":
+	default:
+		problems = append(problems, fmt.Sprintf("FACE_SPOOF_DETECTOR: 未対応のなりすまし検知バックエンドです（%s）", c.SpoofDetector))
+	}
+	if c.SpoofThreshold < 0 || c.SpoofThreshold > 100 {
+		problems = append(problems, "FACE_SPOOF_THRESHOLD: 0〜100で指定してください")
+	}
+	if c.LivenessChallengeTTL <= 0 {
+		problems = append(problems, "FACE_LIVENESS_CHALLENGE_TTL: 0より大きい期間を指定してください")
+	}
+	if c.QrTokenRotationInterval <= 0 {
+		problems = append(problems, "FACE_QR_ROTATION_INTERVAL: 0より大きい期間を指定してください")
+	}
+	if c.QrTokenTTL < c.QrTokenRotationInterval {
+		problems = append(problems, "FACE_QR_TOKEN_TTL: ローテーションの間隔以上の期間を指定してください")
+	}
+	if c.QrTokenMaxUses < 0 {
+		problems = append(problems, "FACE_QR_MAX_USES: 0以上を指定してください")
+	}
+	if c.QrImageSize < 64 || c.QrImageSize > 2048 {
+		problems = append(problems, "FACE_QR_IMAGE_SIZE: 64〜2048で指定してください")
+	}
+	switch c.QrImageRecoveryLevel {
+	case "low", "medium", "high", "highest":
+	default:
+		problems = append(problems, fmt.Sprintf("FACE_QR_IMAGE_RECOVERY_LEVEL: 未対応の誤り訂正レベルです（%s）", c.QrImageRecoveryLevel))
+	}
+	thresholds := policy.Thresholds{Accept: c.FaceAcceptThreshold, Review: c.FaceReviewThreshold}
+	if err := thresholds.Validate(); err != nil {
+		problems = append(problems, fmt.Sprintf("FACE_REVIEW_THRESHOLD: %v（accept %v、review %v）", err, c.FaceAcceptThreshold, c.FaceReviewThreshold))
+	}
+	return problems
+}
+
+func sectionLabel(section string) string {
+	if section == envSection {
+		return "<実行環境>"
 	}
+	return section
 }
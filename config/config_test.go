@@ -0,0 +1,306 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIni = `
+[env]
+go_env = staging
+
+[staging]
+db_host = db.staging
+db_port = 3307
+db_max_open_conns = 10
+
+[key]
+secret = from-file
+session_key = session
+qr_key = qr
+
+[aws]
+region = ap-northeast-1
+bucket = face-bucket
+collection_id = face-collection
+`
+
+func writeIni(t *testing.T, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "face-recognition-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "config.ini")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func envMap(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
+}
+
+func TestLoadLayering(t *testing.T) {
+	path := writeIni(t, testIni)
+	env := envMap(map[string]string{
+		"FACE_DB_HOST": "db.env",
+		"FACE_SECRET":  "from-env",
+	})
+	cfg, args, err := load([]string{"-config", path, "-secret", "from-flag", "migrate", "up"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Env != "staging" {
+		t.Errorf("Env: got %s", cfg.Env)
+	}
+	// 環境変数 > 設定ファイル
+	if cfg.DbHost != "db.env" {
+		t.Errorf("DbHost: got %s", cfg.DbHost)
+	}
+	// 設定ファイル（実行環境のセクション） > デフォルト値
+	if cfg.DbPort != "3307" || cfg.DbMaxOpenConns != 10 {
+		t.Errorf("DbPort/DbMaxOpenConns: got %s/%d", cfg.DbPort, cfg.DbMaxOpenConns)
+	}
+	// デフォルト値
+	if cfg.DbConnMaxLifetime != 5*time.Minute || cfg.LoggerLevel != "info" {
+		t.Errorf("DbConnMaxLifetime/LoggerLevel: got %v/%s", cfg.DbConnMaxLifetime, cfg.LoggerLevel)
+	}
+	// コマンドライン引数 > 環境変数
+	if cfg.Secret != "from-flag" {
+		t.Errorf("Secret: got %s", cfg.Secret)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("args: got %v", args)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	path := writeIni(t, "[dev]\ndb_conn_max_lifetime = forever\n")
+	_, _, err := load([]string{"-config", path}, envMap(nil))
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("ValidationErrorにならなかった: %v", err)
+	}
+	// すべての問題がまとめて報告される
+	want := []string{"FACE_DB_CONN_MAX_LIFETIME", "FACE_SESSION_KEY", "FACE_QR_KEY", "FACE_AWS_REGION", "FACE_AWS_BUCKET", "FACE_AWS_COLLECTION_ID"}
+	if len(verr.Problems) != len(want) {
+		t.Fatalf("問題の件数: got %v", verr.Problems)
+	}
+	for i, name := range want {
+		if !strings.HasPrefix(verr.Problems[i], name) {
+			t.Errorf("問題%d: got %s, want %s", i, verr.Problems[i], name)
+		}
+	}
+}
+
+func TestLoadMigrate(t *testing.T) {
+	// マイグレーションでは署名鍵・AWSなどの設定がなくてもよい
+	path := writeIni(t, "[env]\ngo_env = staging\n")
+	cfg, args, err := load([]string{"-config", path, "migrate", "up"}, envMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Errorf("args: got %v", args)
+	}
+	// 実行環境のセクションがなければ警告にとどめる
+	if len(cfg.Warnings) != 1 || !strings.HasPrefix(cfg.Warnings[0], "FACE_ENV") {
+		t.Errorf("警告: got %v", cfg.Warnings)
+	}
+	// DB接続の設定は検証する
+	_, _, err = load([]string{"-config", path, "-db-max-open-conns", "0", "migrate"}, envMap(nil))
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != 1 || !strings.HasPrefix(verr.Problems[0], "FACE_DB_MAX_OPEN_CONNS") {
+		t.Errorf("DB接続の設定の検証: got %v", err)
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	// 明示的に指定した設定ファイルがなければエラー
+	if _, _, err := load([]string{"-config", "not-found.ini"}, envMap(nil)); err == nil {
+		t.Error("存在しない設定ファイルでエラーにならなかった")
+	}
+	// 設定ファイルがなくても環境変数のみで起動できる（テストの作業ディレクトリにconfig.iniはない）
+	cfg, _, err := load(nil, envMap(map[string]string{
+		"FACE_SESSION_KEY":     "session",
+		"FACE_QR_KEY":          "qr",
+		"FACE_MATCHER":         "fake",
+		"FACE_STORAGE_BACKEND": "memory",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Env != "dev" || cfg.DbDriverName != "mysql" {
+		t.Errorf("デフォルト値: got %s/%s", cfg.Env, cfg.DbDriverName)
+	}
+	if !cfg.LogRequestBody || strings.Join(cfg.LogRequestBodyRedactFields, ",") != "password,photo,frames,qrToken,refreshToken" {
+		t.Errorf("リクエストボディのログ出力: got %v/%v", cfg.LogRequestBody, cfg.LogRequestBodyRedactFields)
+	}
+}
+
+func TestLoadThresholds(t *testing.T) {
+	env := map[string]string{
+		"FACE_SESSION_KEY":     "session",
+		"FACE_QR_KEY":          "qr",
+		"FACE_MATCHER":         "fake",
+		"FACE_STORAGE_BACKEND": "memory",
+	}
+	cfg, _, err := load(nil, envMap(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.FaceAcceptThreshold != 90 || cfg.FaceReviewThreshold != 80 {
+		t.Errorf("デフォルト値: got %v/%v", cfg.FaceAcceptThreshold, cfg.FaceReviewThreshold)
+	}
+	// 要確認のしきい値は本人と判定するしきい値以下
+	env["FACE_ACCEPT_THRESHOLD"] = "85.5"
+	env["FACE_REVIEW_THRESHOLD"] = "90"
+	_, _, err = load(nil, envMap(env))
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != 1 || !strings.HasPrefix(verr.Problems[0], "FACE_REVIEW_THRESHOLD") {
+		t.Errorf("しきい値の検証: got %v", err)
+	}
+	// 0では類似度0も本人と判定してしまう
+	env["FACE_ACCEPT_THRESHOLD"] = "0"
+	env["FACE_REVIEW_THRESHOLD"] = "0"
+	_, _, err = load(nil, envMap(env))
+	if verr, ok := err.(*ValidationError); !ok || len(verr.Problems) != 1 {
+		t.Errorf("しきい値0の検証: got %v", err)
+	}
+	env["FACE_ACCEPT_THRESHOLD"] = "high"
+	if _, _, err := load(nil, envMap(env)); err == nil {
+		t.Error("数値でないしきい値でエラーにならなかった")
+	}
+}
+
+func TestLoadSpoofDetector(t *testing.T) {
+	env := map[string]string{
+		"FACE_SESSION_KEY":     "session",
+		"FACE_QR_KEY":          "qr",
+		"FACE_MATCHER":         "fake",
+		"FACE_STORAGE_BACKEND": "memory",
+	}
+	cfg, _, err := load(nil, envMap(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SpoofDetector != "none" || cfg.SpoofThreshold != 50 {
+		t.Errorf("デフォルト値: got %v/%v", cfg.SpoofDetector, cfg.SpoofThreshold)
+	}
+	env["FACE_SPOOF_DETECTOR"] = "unknown"
+	env["FACE_SPOOF_THRESHOLD"] = "101"
+	_, _, err = load(nil, envMap(env))
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != 2 || !strings.HasPrefix(verr.Problems[0], "FACE_SPOOF_DETECTOR") || !strings.HasPrefix(verr.Problems[1], "FACE_SPOOF_THRESHOLD") {
+		t.Errorf("なりすまし検知の検証: got %v", err)
+	}
+}
+
+func TestLoadQrToken(t *testing.T) {
+	env := map[string]string{
+		"FACE_SESSION_KEY":     "session",
+		"FACE_QR_KEY":          "qr",
+		"FACE_MATCHER":         "fake",
+		"FACE_STORAGE_BACKEND": "memory",
+	}
+	cfg, _, err := load(nil, envMap(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.QrTokenTTL != 5*time.Minute || cfg.QrTokenRotationInterval != time.Minute {
+		t.Errorf("デフォルト値: got %v/%v", cfg.QrTokenTTL, cfg.QrTokenRotationInterval)
+	}
+	// 有効期限はローテーションの間隔以上
+	env["FACE_QR_TOKEN_TTL"] = "30s"
+	_, _, err = load(nil, envMap(env))
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != 1 || !strings.HasPrefix(verr.Problems[0], "FACE_QR_TOKEN_TTL") {
+		t.Errorf("有効期限の検証: got %v", err)
+	}
+}
+
+func TestLoadQrTokenMaxUses(t *testing.T) {
+	env := map[string]string{
+		"FACE_SESSION_KEY":     "session",
+		"FACE_QR_KEY":          "qr",
+		"FACE_MATCHER":         "fake",
+		"FACE_STORAGE_BACKEND": "memory",
+	}
+	cfg, _, err := load(nil, envMap(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.QrTokenMaxUses != 1 {
+		t.Errorf("デフォルト値: got %v", cfg.QrTokenMaxUses)
+	}
+	env["FACE_QR_MAX_USES"] = "-1"
+	_, _, err = load(nil, envMap(env))
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != 1 || !strings.HasPrefix(verr.Problems[0], "FACE_QR_MAX_USES") {
+		t.Errorf("利用回数の検証: got %v", err)
+	}
+}
+
+func TestLoadQrImage(t *testing.T) {
+	env := map[string]string{
+		"FACE_SESSION_KEY":     "session",
+		"FACE_QR_KEY":          "qr",
+		"FACE_MATCHER":         "fake",
+		"FACE_STORAGE_BACKEND": "memory",
+	}
+	cfg, _, err := load(nil, envMap(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.QrImageSize != 256 || cfg.QrImageRecoveryLevel != "medium" {
+		t.Errorf("デフォルト値: got %v/%v", cfg.QrImageSize, cfg.QrImageRecoveryLevel)
+	}
+	env["FACE_QR_IMAGE_SIZE"] = "32"
+	env["FACE_QR_IMAGE_RECOVERY_LEVEL"] = "max"
+	_, _, err = load(nil, envMap(env))
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Problems) != 2 || !strings.HasPrefix(verr.Problems[0], "FACE_QR_IMAGE_SIZE") || !strings.HasPrefix(verr.Problems[1], "FACE_QR_IMAGE_RECOVERY_LEVEL") {
+		t.Errorf("QRコード画像の検証: got %v", err)
+	}
+}
+
+func TestLoadRepositoryIni(t *testing.T) {
+	data, err := ioutil.ReadFile("../config.ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// デフォルト値と異なる値に書き換え、読み込むセクションに書かれていることを確認する
+	content := string(data)
+	for _, r := range [][2]string{
+		{"spoof_detector = none", "spoof_detector = heuristic"},
+		{"spoof_threshold = 50", "spoof_threshold = 65"},
+		{"liveness_required = true", "liveness_required = false"},
+		{"liveness_challenge_ttl = 1m", "liveness_challenge_ttl = 90s"},
+	} {
+		if !strings.Contains(content, r[0]+"\n") {
+			t.Fatalf("config.iniに%sがありません", r[0])
+		}
+		content = strings.Replace(content, r[0]+"\n", r[1]+"\n", 1)
+	}
+	// 同梱の設定ファイルは環境変数なしで検証を通る
+	cfg, _, err := load([]string{"-config", writeIni(t, content)}, envMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SpoofDetector != "heuristic" || cfg.SpoofThreshold != 65 {
+		t.Errorf("なりすまし検知: got %v/%v", cfg.SpoofDetector, cfg.SpoofThreshold)
+	}
+	if cfg.LivenessRequired || cfg.LivenessChallengeTTL != 90*time.Second {
+		t.Errorf("ライブネスチャレンジ: got %v/%v", cfg.LivenessRequired, cfg.LivenessChallengeTTL)
+	}
+}
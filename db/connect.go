@@ -8,16 +8,26 @@ import (
 )
 
 // DB接続
-func SqlConnect() (database *gorm.DB, err error) {
+// 生成したコネクションプールはサーバ起動時に1度だけ作成し、全リクエストで共有する
+func Open(cfg *config.ConfigList) (database *gorm.DB, err error) {
 	dbConnectInfo := fmt.Sprintf(
 		`%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local`,
-		config.Config.DbUserName,
-		config.Config.DbUserPassword,
-		config.Config.DbHost,
-		config.Config.DbPort,
-		config.Config.DbName,
+		cfg.DbUserName,
+		cfg.DbUserPassword,
+		cfg.DbHost,
+		cfg.DbPort,
+		cfg.DbName,
 	)
-	fmt.Println(dbConnectInfo)
-
-	return gorm.Open(config.Config.DbDriverName, dbConnectInfo)
-}
\ No newline at end of file
+	database, err = gorm.Open(cfg.DbDriverName, dbConnectInfo)
+	if err != nil {
+		return nil, err
+	}
+	// ログ出力有効
+	database.LogMode(true)
+	// コネクションプールの設定
+	sqlDB := database.DB()
+	sqlDB.SetMaxOpenConns(cfg.DbMaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DbMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.DbConnMaxLifetime)
+	return database, nil
+}
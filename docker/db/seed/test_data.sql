@@ -3,5 +3,8 @@
 INSERT INTO mst_user(password, email, username, photo, s3_key, created_at)
     VALUES ('xxxx', 'test1@test.co.jp', 'テスト太郎1', 'xxx.jpg', 'sasakinozomi-smile.jpg', CURRENT_TIMESTAMP);
 -- 管理者
-INSERT INTO mst_user(password, email, username, photo, s3_key, is_admin, created_at)
-    VALUES ('xxxx', 'admin@test.co.jp', '管理者太郎1', 'xxx.jpg', 'sasakinozomi-smile.jpg', true, CURRENT_TIMESTAMP);
\ No newline at end of file
+INSERT INTO mst_user(password, email, username, photo, s3_key, is_admin, role, created_at)
+    VALUES ('xxxx', 'admin@test.co.jp', '管理者太郎1', 'xxx.jpg', 'sasakinozomi-smile.jpg', true, 'admin', CURRENT_TIMESTAMP);
+-- 顔認証端末
+INSERT INTO mst_user(password, email, username, photo, s3_key, role, created_at)
+    VALUES ('xxxx', 'kiosk@test.co.jp', '受付端末1', 'xxx.jpg', 'sasakinozomi-smile.jpg', 'kiosk', CURRENT_TIMESTAMP);
\ No newline at end of file
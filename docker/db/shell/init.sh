@@ -1,5 +1,4 @@
 #!/usr/bin/env bash
 
+# テーブルはアプリケーションのmigrateサブコマンドで作成する
 mysql -u testUser -pPassword123 sun < "/docker-entrypoint-initdb.d/1_create_database.sql"
-mysql -u testUser -pPassword123 sun < "/docker-entrypoint-initdb.d/2_ddl.sql"
-mysql -u testUser -pPassword123 sun < "/docker-entrypoint-initdb.d/3_dml.sql"
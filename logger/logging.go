@@ -1,14 +1,13 @@
 package logger
 
 import (
-	"face-recognition/config"
-	"fmt"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 var (
-	Log *zap.Logger
+	// Initが呼ばれるまでは何も出力しない
+	Log = zap.NewNop()
 )
 
 type envVals struct {
@@ -18,14 +17,13 @@ type envVals struct {
 }
 
 // ログに関する環境変数を設定
-func getEnv() (*envVals, error) {
+func getEnv(filePath string, level string) (*envVals, error) {
 	res := envVals{}
 	// ログ出力先
-	res.filePath = config.Config.LoggerFilePath
+	res.filePath = filePath
 	// 標準出力する
 	res.stdout = true
 	// ログレベル
-	level := config.Config.LoggerLevel
 	switch level {
 	case "debug":
 		res.level = zapcore.DebugLevel
@@ -37,12 +35,11 @@ func getEnv() (*envVals, error) {
 	return &res, nil
 }
 
-// 初期処理
-func init() {
-	envVals, err := getEnv()
+// 初期処理（起動時にmainから呼び出す）
+func Init(filePath string, level string) error {
+	envVals, err := getEnv(filePath, level)
 	if err != nil {
-		fmt.Println(err)
-		panic(err)
+		return err
 	}
 	// ログ出力先の設定
 	var outputPaths []string
@@ -69,6 +66,7 @@ func init() {
 		},
 	}
 	if Log, err = logConfig.Build(); err != nil {
-		panic(err)
+		return err
 	}
+	return nil
 }
\ No newline at end of file
@@ -1,12 +1,126 @@
 package main
 
 import (
+	"face-recognition/api"
+	"face-recognition/auth"
+	"face-recognition/aws"
+	"face-recognition/config"
+	"face-recognition/db"
+	"face-recognition/logger"
+	"face-recognition/matcher"
+	"face-recognition/policy"
 	"face-recognition/route"
+	"face-recognition/spoof"
+	"face-recognition/storage"
+	"github.com/labstack/gommon/log"
+	"go.uber.org/zap"
+	"os"
 )
 
 func main() {
+	// 設定読み込み（デフォルト値 < config.ini < 環境変数 < コマンドライン引数）
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	// ログ出力設定
+	if err := logger.Init(cfg.LoggerFilePath, cfg.LoggerLevel); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	logger.Log.Info("実行環境", zap.String("env", cfg.Env))
+	for _, warning := range cfg.Warnings {
+		logger.Log.Warn(warning)
+	}
+	// DB接続（コネクションプールはサーバ全体で共有する）
+	database, err := db.Open(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect database: %v", err)
+	}
+	defer database.Close()
+	// マイグレーション（migrateサブコマンド）の場合はサーバを起動しない
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(database, args[1:]); err != nil {
+			log.Fatalf("Failed to migrate: %v", err)
+		}
+		return
+	}
+	// AWSクライアント生成（S3・Rekognitionで共有する）
+	awsClient := aws.NewClient(aws.Config{
+		Region:          cfg.Region,
+		AccessKeyId:     cfg.AccessKeyId,
+		SecretAccessKey: cfg.SecretAccessKey,
+		Bucket:          cfg.Bucket,
+		CollectionId:    cfg.CollectionId,
+	})
+	// 顔照合エンジン生成（バックエンドはconfig.iniで切り替える）
+	faceMatcher, err := matcher.New(matcher.Options{
+		Backend:         cfg.FaceMatcher,
+		AWS:             awsClient,
+		FakeFixturePath: cfg.FakeFixturePath,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create face matcher: %v", err)
+	}
+	// なりすまし検知エンジン生成（noneなら検知しない）
+	spoofDetector, err := spoof.New(cfg.SpoofDetector)
+	if err != nil {
+		log.Fatalf("Failed to create spoof detector: %v", err)
+	}
+	// 画像ストレージ生成（バックエンドはconfig.iniで切り替える）
+	store, err := storage.New(storage.Options{
+		Backend:    cfg.StorageBackend,
+		AWS:        awsClient,
+		LocalDir:   cfg.StorageLocalDir,
+		BaseURL:    cfg.StorageBaseURL,
+		SigningKey: cfg.Secret,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create image store: %v", err)
+	}
+	// JWTの署名鍵（セッション用とQRトークン用で分け、ローテーション前の鍵も期限まで検証に使う）
+	sessionKeys, err := auth.NewKeyring(
+		auth.Key{Id: cfg.SessionKeyId, Secret: []byte(cfg.SessionKey)},
+		auth.Key{Id: cfg.SessionPreviousKeyId, Secret: []byte(cfg.SessionPreviousKey), ExpiresAt: cfg.SessionPreviousKeyExpiresAt},
+	)
+	if err != nil {
+		log.Fatalf("Failed to create session keyring: %v", err)
+	}
+	qrKeys, err := auth.NewKeyring(
+		auth.Key{Id: cfg.QrKeyId, Secret: []byte(cfg.QrKey)},
+		auth.Key{Id: cfg.QrPreviousKeyId, Secret: []byte(cfg.QrPreviousKey), ExpiresAt: cfg.QrPreviousKeyExpiresAt},
+	)
+	if err != nil {
+		log.Fatalf("Failed to create QR token keyring: %v", err)
+	}
 	// 初期設定（echoインスタンス生成などはrouteの役割）
-	router := route.Init()
+	server := api.NewServer(database, store, faceMatcher, sessionKeys, qrKeys)
+	server.AccessTokenTTL = cfg.AccessTokenTTL
+	server.RefreshTokenTTL = cfg.RefreshTokenTTL
+	server.QrTokenTTL = cfg.QrTokenTTL
+	server.QrTokenRotationInterval = cfg.QrTokenRotationInterval
+	server.QrTokenMaxUses = cfg.QrTokenMaxUses
+	server.QrImageSize = cfg.QrImageSize
+	server.QrImageRecoveryLevel = cfg.QrImageRecoveryLevel
+	server.Policy = policy.Policy{Default: policy.Thresholds{Accept: cfg.FaceAcceptThreshold, Review: cfg.FaceReviewThreshold}}
+	server.Spoof = spoofDetector
+	server.SpoofThreshold = cfg.SpoofThreshold
+	server.LivenessRequired = cfg.LivenessRequired
+	server.LivenessChallengeTTL = cfg.LivenessChallengeTTL
+	// 顔検索の索引登録（index-facesサブコマンド）の場合はサーバを起動しない
+	if len(args) > 0 && args[0] == "index-faces" {
+		indexed, err := server.IndexPendingEnrollments()
+		log.Infof("indexed %d faces", indexed)
+		if err != nil {
+			log.Fatalf("Failed to index faces: %v", err)
+		}
+		return
+	}
+	router := route.Init(server, route.BodyLogConfig{
+		Enabled:       cfg.LogRequestBody,
+		MaxBytes:      cfg.LogRequestBodyMaxBytes,
+		RedactFields:  cfg.LogRequestBodyRedactFields,
+		ExcludeRoutes: cfg.LogRequestBodyExcludeRoutes,
+	})
 	// サーバ起動
 	router.Logger.Fatal(router.Start(":1323"))
-}
\ No newline at end of file
+}
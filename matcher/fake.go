@@ -0,0 +1,290 @@
+package matcher
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// フィクスチャに台本がない組み合わせの類似度の上限（デフォルトのしきい値では必ず不一致になる値）
+const fakeUnscriptedMaxSimilarity = 50.0
+
+// 顔比較の台本
+// Source/Targetには画像のキー、または"sha256:<画像データのハッシュ値>"を指定する
+type FakeComparison struct {
+	Source     string  `json:"source"`
+	Target     string  `json:"target"`
+	Similarity float64 `json:"similarity"`
+}
+
+// 顔検出の台本（画像に写っている顔の数）
+type FakeDetection struct {
+	Image string `json:"image"`
+	Faces int    `json:"faces"`
+}
+
+// ローカル顔照合エンジンのフィクスチャ
+type FakeFixture struct {
+	Comparisons []FakeComparison `json:"comparisons"`
+	Detections  []FakeDetection  `json:"detections"`
+}
+
+// ネットワークを使わない決定的な顔照合エンジン（開発・CI用）
+// 台本にある組み合わせは台本どおりの類似度を、それ以外は同一画像なら100、
+// 異なる画像なら画像の組み合わせから決まる不一致の値を返す
+type FakeMatcher struct {
+	mu          sync.Mutex
+	comparisons map[[2]string]float64
+	detections  map[string]int
+	// 台本の顔の詳細（未設定なら品質に問題のない顔とする）
+	details map[string]FaceDetail
+	// 設定されていれば、すべての呼び出しでこのエラーを返す（バックエンド障害の再現）
+	err error
+	// 設定されていれば、索引の更新（IndexFace・DeleteFaces）でこのエラーを返す
+	indexErr error
+	// 索引登録された顔（顔ID→登録内容）
+	indexed map[string]fakeIndexedFace
+}
+
+// 索引登録された顔（検索時に総当たりで比較する）
+type fakeIndexedFace struct {
+	externalId string
+	image      Image
+}
+
+func NewFakeMatcher(fixture *FakeFixture) *FakeMatcher {
+	m := &FakeMatcher{
+		comparisons: map[[2]string]float64{},
+		detections:  map[string]int{},
+		details:     map[string]FaceDetail{},
+		indexed:     map[string]fakeIndexedFace{},
+	}
+	if fixture != nil {
+		for _, c := range fixture.Comparisons {
+			m.comparisons[[2]string{c.Source, c.Target}] = c.Similarity
+		}
+		for _, d := range fixture.Detections {
+			m.detections[d.Image] = d.Faces
+		}
+	}
+	return m
+}
+
+// フィクスチャファイル（JSON）読み込み
+func LoadFakeFixture(path string) (*FakeFixture, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fixture := &FakeFixture{}
+	if err := json.Unmarshal(data, fixture); err != nil {
+		return nil, err
+	}
+	return fixture, nil
+}
+
+// 台本の類似度を登録（テストから直接設定する場合に利用）
+func (m *FakeMatcher) SetSimilarity(source string, target string, similarity float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.comparisons[[2]string{source, target}] = similarity
+}
+
+// 台本の顔の数を登録（テストから直接設定する場合に利用）
+func (m *FakeMatcher) SetFaces(image string, faces int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.detections[image] = faces
+}
+
+// バックエンド障害を再現する（nilで解除）
+func (m *FakeMatcher) SetError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// 顔検索の索引の障害を再現する（nilで解除）
+func (m *FakeMatcher) SetIndexError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.indexErr = err
+}
+
+// 顔IDが索引に登録されているか（テストから確認する場合に利用）
+func (m *FakeMatcher) Indexed(faceId string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.indexed[faceId]
+	return ok
+}
+
+// 台本の顔の詳細を登録（テストから直接設定する場合に利用）
+func (m *FakeMatcher) SetFaceDetail(image string, detail FaceDetail) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.details[image] = detail
+}
+
+func (m *FakeMatcher) CompareFaces(source Image, target Image) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return 0, m.err
+	}
+	// Rekognitionと同様、顔が写っていない画像は比較できない
+	if m.faceCount(source) == 0 || m.faceCount(target) == 0 {
+		return 0, ErrNoFace
+	}
+	similarity, ok := m.scriptedSimilarity(source, target)
+	if !ok {
+		similarity = hashSimilarity(imageId(source), imageId(target))
+	}
+	return similarity, nil
+}
+
+func (m *FakeMatcher) DetectFaces(image Image) ([]FaceDetail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	count := m.faceCount(image)
+	detail := FaceDetail{
+		Confidence:         99.9,
+		BoundingBox:        BoundingBox{Left: 0.25, Top: 0.25, Width: 0.5, Height: 0.5},
+		Sharpness:          90,
+		EyesOpen:           true,
+		EyesOpenConfidence: 99,
+	}
+	for _, id := range imageIds(image) {
+		if d, ok := m.details[id]; ok {
+			detail = d
+			break
+		}
+	}
+	faces := make([]FaceDetail, 0, count)
+	for i := 0; i < count; i++ {
+		faces = append(faces, detail)
+	}
+	return faces, nil
+}
+
+func (m *FakeMatcher) IndexFace(externalId string, image Image) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return "", m.err
+	}
+	if m.indexErr != nil {
+		return "", m.indexErr
+	}
+	// Rekognitionと同様、顔が写っていない画像は登録しない
+	if m.faceCount(image) == 0 {
+		return "", nil
+	}
+	sum := sha256.Sum256([]byte(externalId + "|" + imageId(image)))
+	faceId := "fake-" + hex.EncodeToString(sum[:8])
+	m.indexed[faceId] = fakeIndexedFace{externalId: externalId, image: image}
+	return faceId, nil
+}
+
+func (m *FakeMatcher) SearchFaces(image Image, maxFaces int) ([]FaceMatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	var matches []FaceMatch
+	for faceId, face := range m.indexed {
+		similarity, ok := m.scriptedSimilarity(face.image, image)
+		if !ok {
+			similarity = hashSimilarity(imageId(face.image), imageId(image))
+		}
+		matches = append(matches, FaceMatch{FaceId: faceId, ExternalId: face.externalId, Similarity: similarity})
+	}
+	// 類似度の高い順（同じ類似度なら顔ID順で決定的にする）
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Similarity != matches[j].Similarity {
+			return matches[i].Similarity > matches[j].Similarity
+		}
+		return matches[i].FaceId < matches[j].FaceId
+	})
+	if len(matches) > maxFaces {
+		matches = matches[:maxFaces]
+	}
+	return matches, nil
+}
+
+func (m *FakeMatcher) DeleteFaces(faceIds []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.indexErr != nil {
+		return m.indexErr
+	}
+	for _, faceId := range faceIds {
+		delete(m.indexed, faceId)
+	}
+	return nil
+}
+
+// 台本の顔の数（台本がなければ1）
+func (m *FakeMatcher) faceCount(image Image) int {
+	for _, id := range imageIds(image) {
+		if n, ok := m.detections[id]; ok {
+			return n
+		}
+	}
+	return 1
+}
+
+// 画像の組み合わせに対応する台本を探す
+func (m *FakeMatcher) scriptedSimilarity(source Image, target Image) (float64, bool) {
+	for _, s := range imageIds(source) {
+		for _, t := range imageIds(target) {
+			if similarity, ok := m.comparisons[[2]string{s, t}]; ok {
+				return similarity, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// 台本の照合に使う画像の識別子（キーと画像データのハッシュ値）
+func imageIds(image Image) []string {
+	var ids []string
+	if image.Key != "" {
+		ids = append(ids, image.Key)
+	}
+	if image.Bytes != nil {
+		ids = append(ids, contentId(image.Bytes))
+	}
+	return ids
+}
+
+// 画像データがあればハッシュ値を、なければキーを画像の識別子とする
+func imageId(image Image) string {
+	if image.Bytes != nil {
+		return contentId(image.Bytes)
+	}
+	return image.Key
+}
+
+func contentId(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// 同一画像は100、異なる画像は組み合わせから決まる不一致の値
+func hashSimilarity(source string, target string) float64 {
+	if source == target {
+		return 100
+	}
+	sum := sha256.Sum256([]byte(source + "|" + target))
+	n := binary.BigEndian.Uint64(sum[:8])
+	return float64(n%10000) / 10000 * fakeUnscriptedMaxSimilarity
+}
@@ -0,0 +1,105 @@
+package matcher
+
+import (
+	"errors"
+	"face-recognition/aws"
+	"fmt"
+)
+
+// 比較する画像に顔が写っていない（CompareFacesが返す）
+var ErrNoFace = errors.New("画像に顔が写っていません")
+
+// 顔照合バックエンド名（config.iniの[face] matcherに指定する）
+const (
+	BackendRekognition = "rekognition"
+	BackendFake        = "fake"
+)
+
+// 顔照合エンジンの生成オプション
+type Options struct {
+	Backend string
+	// AWS Rekognitionの接続に利用するクライアント
+	AWS *aws.Client
+	// ローカル顔照合エンジン（fake）のフィクスチャファイル（未指定なら台本なし）
+	FakeFixturePath string
+}
+
+// 照合対象の画像
+// Bytesが設定されていればその画像データを、なければKeyが指すストレージ上の画像を利用する
+type Image struct {
+	Key   string
+	Bytes []byte
+}
+
+// 画像内の顔の位置（画像サイズに対する比率：0-1）
+type BoundingBox struct {
+	Left   float64
+	Top    float64
+	Width  float64
+	Height float64
+}
+
+// 顔の向き（度：正面が0）
+type Pose struct {
+	Yaw   float64
+	Pitch float64
+	Roll  float64
+}
+
+// 検出した顔の情報
+type FaceDetail struct {
+	// 顔である確からしさ（0-100）
+	Confidence  float64
+	BoundingBox BoundingBox
+	// 鮮明さ（0-100：大きいほど鮮明）
+	Sharpness float64
+	// 目を開いているかとその確からしさ（0-100）
+	EyesOpen           bool
+	EyesOpenConfidence float64
+	Pose               Pose
+}
+
+// 索引から検索した顔
+type FaceMatch struct {
+	// バックエンド上の顔ID
+	FaceId string
+	// 索引登録時に指定した外部ID
+	ExternalId string
+	// 類似度（0-100）
+	Similarity float64
+}
+
+// 顔照合エンジン
+// ハンドラはこのインターフェースにのみ依存し、実装はデプロイ環境ごとに切り替える
+type FaceMatcher interface {
+	// 2つの画像の顔を比較し、類似度（0-100）を返す（本人かどうかの判定は呼び出し側のしきい値で行う）
+	// いずれかの画像に顔が写っていなければErrNoFaceを返す
+	CompareFaces(source Image, target Image) (similarity float64, err error)
+	// 画像に写っている顔を検出する
+	DetectFaces(image Image) ([]FaceDetail, error)
+	// 画像の顔を検索用の索引に登録し、バックエンド上の顔IDを返す
+	IndexFace(externalId string, image Image) (faceId string, err error)
+	// 画像の顔に似た顔を索引から検索し、類似度の高い順に最大maxFaces件返す
+	SearchFaces(image Image, maxFaces int) ([]FaceMatch, error)
+	// 索引から顔を削除する
+	DeleteFaces(faceIds []string) error
+}
+
+// 設定値に応じた顔照合エンジンを生成
+func New(opts Options) (FaceMatcher, error) {
+	switch opts.Backend {
+	case "", BackendRekognition:
+		return NewRekognitionMatcher(opts.AWS), nil
+	case BackendFake:
+		if opts.FakeFixturePath == "" {
+			return NewFakeMatcher(nil), nil
+		}
+		fixture, err := LoadFakeFixture(opts.FakeFixturePath)
+		if err != nil {
+			return nil, err
+		}
+		return NewFakeMatcher(fixture), nil
+	default:
+		return nil, fmt.Errorf("未対応の顔照合バックエンドです: %s", opts.Backend)
+	}
+}
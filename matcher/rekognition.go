@@ -0,0 +1,105 @@
+package matcher
+
+import (
+	"face-recognition/aws"
+	"github.com/aws/aws-sdk-go/service/rekognition"
+)
+
+// AWS Rekognitionによる顔照合エンジン
+type RekognitionMatcher struct {
+	client *aws.Client
+}
+
+func NewRekognitionMatcher(client *aws.Client) *RekognitionMatcher {
+	return &RekognitionMatcher{client: client}
+}
+
+func (m *RekognitionMatcher) CompareFaces(source Image, target Image) (float64, error) {
+	similarity, err := m.client.CompareFaces(m.toRekognitionImage(source), m.toRekognitionImage(target))
+	if err == aws.ErrNoFace {
+		return 0, ErrNoFace
+	}
+	return similarity, err
+}
+
+func (m *RekognitionMatcher) DetectFaces(image Image) ([]FaceDetail, error) {
+	details, err := m.client.DetectFaces(m.toRekognitionImage(image))
+	if err != nil {
+		return nil, err
+	}
+	faces := make([]FaceDetail, 0, len(details))
+	for _, d := range details {
+		face := FaceDetail{}
+		if d.Confidence != nil {
+			face.Confidence = *d.Confidence
+		}
+		if box := d.BoundingBox; box != nil {
+			face.BoundingBox = BoundingBox{
+				Left:   floatValue(box.Left),
+				Top:    floatValue(box.Top),
+				Width:  floatValue(box.Width),
+				Height: floatValue(box.Height),
+			}
+		}
+		if q := d.Quality; q != nil {
+			face.Sharpness = floatValue(q.Sharpness)
+		}
+		if e := d.EyesOpen; e != nil {
+			face.EyesOpen = e.Value != nil && *e.Value
+			face.EyesOpenConfidence = floatValue(e.Confidence)
+		}
+		if p := d.Pose; p != nil {
+			face.Pose = Pose{Yaw: floatValue(p.Yaw), Pitch: floatValue(p.Pitch), Roll: floatValue(p.Roll)}
+		}
+		faces = append(faces, face)
+	}
+	return faces, nil
+}
+
+func (m *RekognitionMatcher) IndexFace(externalId string, image Image) (string, error) {
+	return m.client.IndexFaces(externalId, m.toRekognitionImage(image))
+}
+
+func (m *RekognitionMatcher) SearchFaces(image Image, maxFaces int) ([]FaceMatch, error) {
+	records, err := m.client.SearchFacesByImage(m.toRekognitionImage(image), int64(maxFaces))
+	if err != nil {
+		return nil, err
+	}
+	matches := make([]FaceMatch, 0, len(records))
+	for _, r := range records {
+		if r.Face == nil {
+			continue
+		}
+		match := FaceMatch{Similarity: floatValue(r.Similarity)}
+		if r.Face.FaceId != nil {
+			match.FaceId = *r.Face.FaceId
+		}
+		if r.Face.ExternalImageId != nil {
+			match.ExternalId = *r.Face.ExternalImageId
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+func (m *RekognitionMatcher) DeleteFaces(faceIds []string) error {
+	if len(faceIds) == 0 {
+		return nil
+	}
+	return m.client.DeleteFaces(faceIds)
+}
+
+// 画像データがあれば直接渡し、なければS3上の画像を参照させる
+func (m *RekognitionMatcher) toRekognitionImage(image Image) *rekognition.Image {
+	if image.Bytes != nil {
+		return aws.BytesImage(image.Bytes)
+	}
+	return m.client.S3Image(image.Key)
+}
+
+func floatValue(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
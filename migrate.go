@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"face-recognition/migration"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strconv"
+)
+
+// migrateサブコマンド
+// migrate up: 未適用のマイグレーションをすべて適用
+// migrate down [n]: 適用済みのマイグレーションを新しい順にn件（省略時は1件）取り消し
+// migrate status: 適用状況を表示
+func runMigrate(database *gorm.DB, args []string) error {
+	migrator := migration.New(database, migration.Migrations)
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "up":
+		done, err := migrator.Up()
+		for _, m := range done {
+			fmt.Printf("applied  %d %s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return errors.New("取り消す件数は1以上の数値で指定してください")
+			}
+			steps = n
+		}
+		done, err := migrator.Down(steps)
+		for _, m := range done {
+			fmt.Printf("reverted %d %s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-4d %-40s %s\n", s.Migration.Version, s.Migration.Name, appliedAt)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未対応のサブコマンドです: migrate %s", command)
+	}
+}
@@ -0,0 +1,156 @@
+package migration
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"sort"
+	"time"
+)
+
+// スキーマ変更1件分
+// Up/Downは順に実行するSQL（MySQLのDDLは暗黙的にコミットされるため、1文ずつ分けて記述する）
+// SQLiteは結合テスト用のDBでUpの代わりに実行するSQL（nilならUpをそのまま実行する。取り消しには対応しない）
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []string
+	Down    []string
+	SQLite  []string
+}
+
+// 適用済みのマイグレーション（schema_migrationsテーブル）
+type SchemaMigration struct {
+	Version   int64     `gorm:"primary_key"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// マイグレーションの適用状況
+type Status struct {
+	Migration Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// マイグレーション実行
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+func New(db *gorm.DB, migrations []Migration) *Migrator {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Migrator{db: db, migrations: sorted}
+}
+
+// schema_migrationsテーブルがなければ作成
+func (m *Migrator) init() error {
+	return m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`).Error
+}
+
+// 適用済みのバージョン一覧
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	var rows []SchemaMigration
+	if err := m.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := map[int64]SchemaMigration{}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// 未適用のマイグレーションを古い順にすべて適用し、適用したものを返す
+func (m *Migrator) Up() ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := m.exec(m.up(migration)); err != nil {
+			return done, fmt.Errorf("マイグレーション%d（%s）の適用に失敗しました: %v", migration.Version, migration.Name, err)
+		}
+		row := SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+		if err := m.db.Create(&row).Error; err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// 適用済みのマイグレーションを新しい順にsteps件取り消し、取り消したものを返す
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := m.exec(migration.Down); err != nil {
+			return done, fmt.Errorf("マイグレーション%d（%s）の取り消しに失敗しました: %v", migration.Version, migration.Name, err)
+		}
+		if err := m.db.Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error; err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// 全マイグレーションの適用状況
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// 接続先のDBで実行する適用用のSQL
+func (m *Migrator) up(migration Migration) []string {
+	if migration.SQLite != nil && m.db.Dialect().GetName() == "sqlite3" {
+		return migration.SQLite
+	}
+	return migration.Up
+}
+
+func (m *Migrator) exec(statements []string) error {
+	for _, statement := range statements {
+		if err := m.db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
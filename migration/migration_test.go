@@ -0,0 +1,110 @@
+package migration
+
+import (
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"testing"
+)
+
+var testMigrations = []Migration{
+	{
+		Version: 2,
+		Name:    "create_bar",
+		Up:      []string{`CREATE TABLE bar (id INTEGER PRIMARY KEY)`},
+		Down:    []string{`DROP TABLE bar`},
+	},
+	{
+		Version: 1,
+		Name:    "create_foo",
+		Up:      []string{`CREATE TABLE foo (id INTEGER PRIMARY KEY)`},
+		Down:    []string{`DROP TABLE foo`},
+	},
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// インメモリDBは接続ごとに別のDBになるため、接続を1本に限定する
+	db.DB().SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUpDown(t *testing.T) {
+	db := openTestDB(t)
+	migrator := New(db, testMigrations)
+
+	done, err := migrator.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 || done[0].Version != 1 || done[1].Version != 2 {
+		t.Fatalf("バージョン順に適用されていない: %+v", done)
+	}
+	if !db.HasTable("foo") || !db.HasTable("bar") {
+		t.Fatal("テーブルが作成されていない")
+	}
+	// 適用済みのものは再適用しない
+	if done, err := migrator.Up(); err != nil || len(done) != 0 {
+		t.Fatalf("再適用された: %+v %v", done, err)
+	}
+
+	done, err = migrator.Down(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].Version != 2 {
+		t.Fatalf("新しいものから取り消されていない: %+v", done)
+	}
+	if db.HasTable("bar") || !db.HasTable("foo") {
+		t.Fatal("取り消し結果が不正")
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("適用状況が不正: %+v", statuses)
+	}
+}
+
+func TestUpFailure(t *testing.T) {
+	db := openTestDB(t)
+	migrations := append([]Migration{{
+		Version: 3,
+		Name:    "broken",
+		Up:      []string{`CREATE TABLE`},
+	}}, testMigrations...)
+	done, err := New(db, migrations).Up()
+	if err == nil {
+		t.Fatal("エラーにならなかった")
+	}
+	// 失敗したマイグレーションより前のものは適用済みとして記録される
+	if len(done) != 2 {
+		t.Errorf("適用済みの件数: got %d, want 2", len(done))
+	}
+	statuses, _ := New(db, migrations).Status()
+	if statuses[2].Applied {
+		t.Error("失敗したマイグレーションが適用済みになっている")
+	}
+}
+
+func TestUpSQLite(t *testing.T) {
+	db := openTestDB(t)
+	migrations := []Migration{{
+		Version: 1,
+		Name:    "create_baz",
+		Up:      []string{`CREATE TABLE baz (id BIGINT NOT NULL AUTO_INCREMENT, PRIMARY KEY (id)) ENGINE = InnoDB`},
+		SQLite:  []string{`CREATE TABLE baz (id INTEGER PRIMARY KEY AUTOINCREMENT)`},
+	}}
+	if _, err := New(db, migrations).Up(); err != nil {
+		t.Fatal(err)
+	}
+	if !db.HasTable("baz") {
+		t.Fatal("SQLite向けのSQLが実行されていない")
+	}
+}
@@ -0,0 +1,492 @@
+package migration
+
+// 全マイグレーション（追加する場合は末尾にバージョンを採番して追記する）
+// 1〜3は既存のdocker/db/sql/2_ddl.sqlで作成済みのDBにも適用できるよう、IF NOT EXISTSで作成する
+// SQLiteには結合テストのDBを作成するSQLを記述する（Upを変更した場合は合わせて変更する）
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_mst_user",
+		Up: []string{`
+			CREATE TABLE IF NOT EXISTS mst_user (
+				id BIGINT NOT NULL AUTO_INCREMENT COMMENT 'Id',
+				email VARCHAR(255) NOT NULL COMMENT 'メールアドレス',
+				username VARCHAR(16) NOT NULL COMMENT 'ユーザ名',
+				password VARCHAR(255) NOT NULL COMMENT 'パスワード',
+				photo VARCHAR(255) NOT NULL COMMENT '写真',
+				s3_key VARCHAR(255) NOT NULL COMMENT 'S3のキー名',
+				is_admin TINYINT(1) NOT NULL DEFAULT 0 COMMENT '管理者フラグ',
+				last_login_at TIMESTAMP NULL DEFAULT NULL COMMENT '最終ログイン日時',
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '作成日',
+				updated_at TIMESTAMP NULL DEFAULT NULL COMMENT '更新日',
+				PRIMARY KEY (id),
+				UNIQUE INDEX email_UNIQUE (email ASC)
+			) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8 COMMENT = 'ユーザマスタ'`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS mst_user`,
+		},
+		SQLite: []string{`
+			CREATE TABLE mst_user (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				email VARCHAR(255) NOT NULL UNIQUE,
+				username VARCHAR(16) NOT NULL,
+				password VARCHAR(255) NOT NULL,
+				photo VARCHAR(255) NOT NULL,
+				s3_key VARCHAR(255) NOT NULL,
+				is_admin BOOLEAN NOT NULL DEFAULT 0,
+				last_login_at TIMESTAMP NULL DEFAULT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NULL DEFAULT NULL
+			)`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_qr_token",
+		Up: []string{`
+			CREATE TABLE IF NOT EXISTS qr_token (
+				id BIGINT NOT NULL AUTO_INCREMENT COMMENT 'Id',
+				mst_user_id BIGINT NOT NULL COMMENT 'ユーザマスタの外部キー',
+				qr_token VARCHAR(255) NOT NULL COMMENT 'QRトークン',
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '作成日',
+				updated_at TIMESTAMP NULL DEFAULT NULL COMMENT '更新日',
+				PRIMARY KEY (id),
+				INDEX fk_mst_user_id_of_qr_token_idx (mst_user_id ASC),
+				CONSTRAINT fk_mst_user_id_of_qr_token
+					FOREIGN KEY (mst_user_id)
+					REFERENCES mst_user (id)
+					ON DELETE NO ACTION
+					ON UPDATE NO ACTION
+			) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8 COMMENT = 'QRトークン'`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS qr_token`,
+		},
+		SQLite: []string{`
+			CREATE TABLE qr_token (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				mst_user_id BIGINT NOT NULL REFERENCES mst_user (id),
+				qr_token VARCHAR(255) NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NULL DEFAULT NULL
+			)`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_face_recognition_result",
+		Up: []string{`
+			CREATE TABLE IF NOT EXISTS face_recognition_result (
+				id INT NOT NULL AUTO_INCREMENT COMMENT 'Id',
+				mst_user_id BIGINT NOT NULL COMMENT 'ユーザマスタの外部キー',
+				source_image VARCHAR(255) NOT NULL COMMENT '比較基の画像',
+				source_image_s3_key VARCHAR(255) NOT NULL COMMENT '比較基画像のs3のキー名',
+				target_image VARCHAR(255) NOT NULL COMMENT '比較先の画像',
+				target_image_s3_key VARCHAR(255) NOT NULL COMMENT '比較先画像のs3のキー名',
+				result DECIMAL(13,10) NOT NULL COMMENT '顔認証結果',
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '作成日',
+				updated_at TIMESTAMP NULL DEFAULT NULL COMMENT '更新日',
+				PRIMARY KEY (id),
+				INDEX fk_mst_user_id_of_face_recognition_result_idx (mst_user_id ASC),
+				CONSTRAINT fk_mst_user_id_of_face_recognition_result
+					FOREIGN KEY (mst_user_id)
+					REFERENCES mst_user (id)
+					ON DELETE NO ACTION
+					ON UPDATE NO ACTION
+			) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8 COMMENT = '顔認証結果'`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS face_recognition_result`,
+		},
+		SQLite: []string{`
+			CREATE TABLE face_recognition_result (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				mst_user_id BIGINT NOT NULL REFERENCES mst_user (id),
+				source_image VARCHAR(255) NOT NULL,
+				source_image_s3_key VARCHAR(255) NOT NULL,
+				target_image VARCHAR(255) NOT NULL,
+				target_image_s3_key VARCHAR(255) NOT NULL,
+				result DECIMAL(13,10) NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NULL DEFAULT NULL
+			)`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_user_session",
+		Up: []string{`
+			CREATE TABLE user_session (
+				id BIGINT NOT NULL AUTO_INCREMENT COMMENT 'Id',
+				session_id VARCHAR(32) NOT NULL COMMENT 'セッションID（アクセストークンのsid）',
+				mst_user_id BIGINT NOT NULL COMMENT 'ユーザマスタの外部キー',
+				refresh_token_hash CHAR(64) NOT NULL COMMENT 'リフレッシュトークンのハッシュ値（SHA-256）',
+				user_agent VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'ログイン時のUser-Agent',
+				ip_address VARCHAR(45) NOT NULL DEFAULT '' COMMENT 'ログイン時のIPアドレス',
+				expires_at DATETIME NOT NULL COMMENT 'リフレッシュトークンの有効期限',
+				last_used_at DATETIME NULL DEFAULT NULL COMMENT '最終リフレッシュ日時',
+				revoked_at DATETIME NULL DEFAULT NULL COMMENT '失効日時',
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '作成日',
+				updated_at TIMESTAMP NULL DEFAULT NULL COMMENT '更新日',
+				PRIMARY KEY (id),
+				UNIQUE INDEX session_id_UNIQUE (session_id ASC),
+				INDEX fk_mst_user_id_of_user_session_idx (mst_user_id ASC),
+				CONSTRAINT fk_mst_user_id_of_user_session
+					FOREIGN KEY (mst_user_id)
+					REFERENCES mst_user (id)
+					ON DELETE NO ACTION
+					ON UPDATE NO ACTION
+			) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8 COMMENT = 'ログインセッション'`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS user_session`,
+		},
+		SQLite: []string{`
+			CREATE TABLE user_session (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				session_id VARCHAR(32) NOT NULL UNIQUE,
+				mst_user_id BIGINT NOT NULL REFERENCES mst_user (id),
+				refresh_token_hash CHAR(64) NOT NULL,
+				user_agent VARCHAR(255) NOT NULL DEFAULT '',
+				ip_address VARCHAR(45) NOT NULL DEFAULT '',
+				expires_at DATETIME NOT NULL,
+				last_used_at DATETIME NULL DEFAULT NULL,
+				revoked_at DATETIME NULL DEFAULT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NULL DEFAULT NULL
+			)`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_role_to_mst_user",
+		Up: []string{
+			`ALTER TABLE mst_user ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'member' COMMENT 'ロール（admin、operator、kiosk、member）' AFTER is_admin`,
+			// 既存の管理者はadminロールにする
+			`UPDATE mst_user SET role = 'admin' WHERE is_admin = 1`,
+		},
+		Down: []string{
+			`ALTER TABLE mst_user DROP COLUMN role`,
+		},
+		SQLite: []string{
+			`ALTER TABLE mst_user ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'member'`,
+			`UPDATE mst_user SET role = 'admin' WHERE is_admin = 1`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_status_and_deleted_at_to_mst_user",
+		Up: []string{
+			`ALTER TABLE mst_user ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active' COMMENT '状態（active、suspended）' AFTER role`,
+			// 削除しても顔認証結果の履歴から参照できるよう、論理削除とする
+			`ALTER TABLE mst_user ADD COLUMN deleted_at DATETIME NULL DEFAULT NULL COMMENT '削除日時' AFTER updated_at`,
+		},
+		Down: []string{
+			`ALTER TABLE mst_user DROP COLUMN deleted_at`,
+			`ALTER TABLE mst_user DROP COLUMN status`,
+		},
+		SQLite: []string{
+			`ALTER TABLE mst_user ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active'`,
+			`ALTER TABLE mst_user ADD COLUMN deleted_at DATETIME NULL DEFAULT NULL`,
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_face_enrollment",
+		Up: []string{`
+			CREATE TABLE face_enrollment (
+				id BIGINT NOT NULL AUTO_INCREMENT COMMENT 'Id',
+				mst_user_id BIGINT NOT NULL COMMENT 'ユーザマスタの外部キー',
+				version INT NOT NULL COMMENT '版数（ユーザごとに1から採番）',
+				photo VARCHAR(255) NOT NULL COMMENT '写真',
+				s3_key VARCHAR(255) NOT NULL COMMENT 'S3のキー名',
+				active TINYINT(1) NOT NULL DEFAULT 0 COMMENT '顔認証に利用中か',
+				deactivated_at DATETIME NULL DEFAULT NULL COMMENT '利用終了日時',
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '作成日',
+				updated_at TIMESTAMP NULL DEFAULT NULL COMMENT '更新日',
+				PRIMARY KEY (id),
+				UNIQUE INDEX mst_user_id_version_UNIQUE (mst_user_id ASC, version ASC),
+				CONSTRAINT fk_mst_user_id_of_face_enrollment
+					FOREIGN KEY (mst_user_id)
+					REFERENCES mst_user (id)
+					ON DELETE NO ACTION
+					ON UPDATE NO ACTION
+			) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8 COMMENT = '顔写真の登録履歴'`,
+			// 登録済みの写真を1版目とする
+			`INSERT INTO face_enrollment (mst_user_id, version, photo, s3_key, active, created_at)
+				SELECT id, 1, photo, s3_key, 1, created_at FROM mst_user`,
+			`ALTER TABLE face_recognition_result
+				ADD COLUMN face_enrollment_id BIGINT NULL DEFAULT NULL COMMENT '比較した顔写真の登録履歴の外部キー' AFTER mst_user_id,
+				ADD CONSTRAINT fk_face_enrollment_id_of_face_recognition_result
+					FOREIGN KEY (face_enrollment_id)
+					REFERENCES face_enrollment (id)
+					ON DELETE NO ACTION
+					ON UPDATE NO ACTION`,
+			`UPDATE face_recognition_result r
+				INNER JOIN face_enrollment e ON e.mst_user_id = r.mst_user_id AND e.version = 1
+				SET r.face_enrollment_id = e.id`,
+		},
+		Down: []string{
+			`ALTER TABLE face_recognition_result DROP FOREIGN KEY fk_face_enrollment_id_of_face_recognition_result`,
+			`ALTER TABLE face_recognition_result DROP COLUMN face_enrollment_id`,
+			`DROP TABLE IF EXISTS face_enrollment`,
+		},
+		SQLite: []string{`
+			CREATE TABLE face_enrollment (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				mst_user_id BIGINT NOT NULL REFERENCES mst_user (id),
+				version INT NOT NULL,
+				photo VARCHAR(255) NOT NULL,
+				s3_key VARCHAR(255) NOT NULL,
+				active BOOLEAN NOT NULL DEFAULT 0,
+				deactivated_at DATETIME NULL DEFAULT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NULL DEFAULT NULL,
+				UNIQUE (mst_user_id, version)
+			)`,
+			`INSERT INTO face_enrollment (mst_user_id, version, photo, s3_key, active, created_at)
+				SELECT id, 1, photo, s3_key, 1, created_at FROM mst_user`,
+			`ALTER TABLE face_recognition_result
+				ADD COLUMN face_enrollment_id BIGINT NULL DEFAULT NULL REFERENCES face_enrollment (id)`,
+			`UPDATE face_recognition_result SET face_enrollment_id = (
+				SELECT e.id FROM face_enrollment e
+				WHERE e.mst_user_id = face_recognition_result.mst_user_id AND e.version = 1)`,
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_label_to_face_enrollment",
+		Up: []string{
+			`ALTER TABLE face_enrollment
+				ADD COLUMN label VARCHAR(32) NOT NULL DEFAULT '' COMMENT 'ラベル（眼鏡あり等）' AFTER version,
+				ADD INDEX mst_user_id_active_INDEX (mst_user_id ASC, active ASC)`,
+		},
+		Down: []string{
+			`ALTER TABLE face_enrollment DROP INDEX mst_user_id_active_INDEX, DROP COLUMN label`,
+		},
+		SQLite: []string{
+			`ALTER TABLE face_enrollment ADD COLUMN label VARCHAR(32) NOT NULL DEFAULT ''`,
+			`CREATE INDEX mst_user_id_active_INDEX ON face_enrollment (mst_user_id, active)`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_face_id_and_method_for_identification",
+		Up: []string{
+			// 既存の顔写真はindex-facesサブコマンドで索引に登録する
+			`ALTER TABLE face_enrollment
+				ADD COLUMN face_id VARCHAR(64) NOT NULL DEFAULT '' COMMENT '顔検索の索引上の顔ID（未登録なら空）' AFTER s3_key,
+				ADD INDEX face_id_INDEX (face_id ASC)`,
+			`ALTER TABLE face_recognition_result
+				ADD COLUMN method VARCHAR(16) NOT NULL DEFAULT 'qr_token' COMMENT '認証方式（qr_token / identification）' AFTER face_enrollment_id`,
+		},
+		Down: []string{
+			`ALTER TABLE face_recognition_result DROP COLUMN method`,
+			`ALTER TABLE face_enrollment DROP INDEX face_id_INDEX, DROP COLUMN face_id`,
+		},
+		SQLite: []string{
+			`ALTER TABLE face_enrollment ADD COLUMN face_id VARCHAR(64) NOT NULL DEFAULT ''`,
+			`CREATE INDEX face_id_INDEX ON face_enrollment (face_id)`,
+			`ALTER TABLE face_recognition_result ADD COLUMN method VARCHAR(16) NOT NULL DEFAULT 'qr_token'`,
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_similarity_thresholds",
+		Up: []string{`
+			CREATE TABLE location_threshold (
+				id BIGINT NOT NULL AUTO_INCREMENT COMMENT 'Id',
+				location VARCHAR(64) NOT NULL COMMENT '設置場所',
+				accept_threshold DECIMAL(5,2) NOT NULL COMMENT '本人と判定する類似度',
+				review_threshold DECIMAL(5,2) NOT NULL COMMENT '要確認とする類似度',
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '作成日',
+				updated_at TIMESTAMP NULL DEFAULT NULL COMMENT '更新日',
+				PRIMARY KEY (id),
+				UNIQUE INDEX location_UNIQUE (location ASC)
+			) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8 COMMENT = '設置場所ごとの判定しきい値'`,
+			`ALTER TABLE mst_user
+				ADD COLUMN accept_threshold DECIMAL(5,2) NULL DEFAULT NULL COMMENT '本人と判定する類似度（個別設定）' AFTER status,
+				ADD COLUMN review_threshold DECIMAL(5,2) NULL DEFAULT NULL COMMENT '要確認とする類似度（個別設定）' AFTER accept_threshold`,
+			`ALTER TABLE face_recognition_result
+				ADD COLUMN location VARCHAR(64) NOT NULL DEFAULT '' COMMENT '設置場所' AFTER method,
+				ADD COLUMN accept_threshold DECIMAL(5,2) NOT NULL DEFAULT 90 COMMENT '判定に使った本人と判定する類似度' AFTER result,
+				ADD COLUMN review_threshold DECIMAL(5,2) NOT NULL DEFAULT 90 COMMENT '判定に使った要確認とする類似度' AFTER accept_threshold,
+				ADD COLUMN threshold_scope VARCHAR(16) NOT NULL DEFAULT 'default' COMMENT 'しきい値の適用元（default / location / user）' AFTER review_threshold,
+				ADD COLUMN decision VARCHAR(16) NOT NULL DEFAULT 'reject' COMMENT '判定（accept / review / reject）' AFTER threshold_scope`,
+			// 既存の結果は固定のしきい値（90）で判定し、しきい値未満は類似度0として記録していた
+			`UPDATE face_recognition_result SET decision = 'accept' WHERE result > 0`,
+		},
+		Down: []string{
+			`ALTER TABLE face_recognition_result
+				DROP COLUMN decision,
+				DROP COLUMN threshold_scope,
+				DROP COLUMN review_threshold,
+				DROP COLUMN accept_threshold,
+				DROP COLUMN location`,
+			`ALTER TABLE mst_user DROP COLUMN review_threshold, DROP COLUMN accept_threshold`,
+			`DROP TABLE IF EXISTS location_threshold`,
+		},
+		SQLite: []string{`
+			CREATE TABLE location_threshold (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				location VARCHAR(64) NOT NULL UNIQUE,
+				accept_threshold DECIMAL(5,2) NOT NULL,
+				review_threshold DECIMAL(5,2) NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NULL DEFAULT NULL
+			)`,
+			`ALTER TABLE mst_user ADD COLUMN accept_threshold DECIMAL(5,2) NULL DEFAULT NULL`,
+			`ALTER TABLE mst_user ADD COLUMN review_threshold DECIMAL(5,2) NULL DEFAULT NULL`,
+			`ALTER TABLE face_recognition_result ADD COLUMN location VARCHAR(64) NOT NULL DEFAULT ''`,
+			`ALTER TABLE face_recognition_result ADD COLUMN accept_threshold DECIMAL(5,2) NOT NULL DEFAULT 90`,
+			`ALTER TABLE face_recognition_result ADD COLUMN review_threshold DECIMAL(5,2) NOT NULL DEFAULT 90`,
+			`ALTER TABLE face_recognition_result ADD COLUMN threshold_scope VARCHAR(16) NOT NULL DEFAULT 'default'`,
+			`ALTER TABLE face_recognition_result ADD COLUMN decision VARCHAR(16) NOT NULL DEFAULT 'reject'`,
+			`UPDATE face_recognition_result SET decision = 'accept' WHERE result > 0`,
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_outcome_to_face_recognition_result",
+		Up: []string{
+			`ALTER TABLE face_recognition_result
+				ADD COLUMN outcome VARCHAR(32) NOT NULL DEFAULT 'not_matched' COMMENT '結果の種類（matched / not_matched / no_face_detected / multiple_faces / low_quality / backend_error）' AFTER decision`,
+			`UPDATE face_recognition_result SET outcome = 'matched' WHERE decision = 'accept'`,
+		},
+		Down: []string{
+			`ALTER TABLE face_recognition_result DROP COLUMN outcome`,
+		},
+		SQLite: []string{
+			`ALTER TABLE face_recognition_result ADD COLUMN outcome VARCHAR(32) NOT NULL DEFAULT 'not_matched'`,
+			`UPDATE face_recognition_result SET outcome = 'matched' WHERE decision = 'accept'`,
+		},
+	},
+	{
+		Version: 12,
+		Name:    "create_liveness_challenge",
+		Up: []string{`
+			CREATE TABLE liveness_challenge (
+				id BIGINT NOT NULL AUTO_INCREMENT COMMENT 'Id',
+				challenge_id VARCHAR(32) NOT NULL COMMENT 'チャレンジID',
+				mst_user_id BIGINT NOT NULL COMMENT 'チャレンジを発行した端末のユーザ',
+				steps VARCHAR(255) NOT NULL COMMENT '求める動作（カンマ区切り）',
+				expires_at DATETIME NOT NULL COMMENT '有効期限',
+				used_at DATETIME NULL DEFAULT NULL COMMENT '顔認証に利用した日時',
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '作成日',
+				updated_at TIMESTAMP NULL DEFAULT NULL COMMENT '更新日',
+				PRIMARY KEY (id),
+				UNIQUE INDEX challenge_id_UNIQUE (challenge_id ASC),
+				INDEX fk_mst_user_id_of_liveness_challenge_idx (mst_user_id ASC),
+				CONSTRAINT fk_mst_user_id_of_liveness_challenge
+					FOREIGN KEY (mst_user_id)
+					REFERENCES mst_user (id)
+					ON DELETE NO ACTION
+					ON UPDATE NO ACTION
+			) ENGINE = InnoDB DEFAULT CHARACTER SET = utf8 COMMENT = 'ライブネスチャレンジ'`,
+			`ALTER TABLE face_recognition_result
+				ADD COLUMN liveness_challenge_id BIGINT NULL DEFAULT NULL COMMENT '顔認証に使ったライブネスチャレンジ' AFTER location`,
+		},
+		Down: []string{
+			`ALTER TABLE face_recognition_result DROP COLUMN liveness_challenge_id`,
+			`DROP TABLE IF EXISTS liveness_challenge`,
+		},
+		SQLite: []string{`
+			CREATE TABLE liveness_challenge (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				challenge_id VARCHAR(32) NOT NULL UNIQUE,
+				mst_user_id BIGINT NOT NULL REFERENCES mst_user (id),
+				steps VARCHAR(255) NOT NULL,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME NULL DEFAULT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP NULL DEFAULT NULL
+			)`,
+			`ALTER TABLE face_recognition_result ADD COLUMN liveness_challenge_id BIGINT NULL DEFAULT NULL`,
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_spoof_score_to_face_recognition_result",
+		Up: []string{
+			`ALTER TABLE face_recognition_result
+				ADD COLUMN spoof_score DECIMAL(5,2) NULL DEFAULT NULL COMMENT 'なりすましスコア（0-100）' AFTER result`,
+		},
+		Down: []string{
+			`ALTER TABLE face_recognition_result DROP COLUMN spoof_score`,
+		},
+		SQLite: []string{
+			`ALTER TABLE face_recognition_result ADD COLUMN spoof_score DECIMAL(5,2) NULL DEFAULT NULL`,
+		},
+	},
+	{
+		Version: 14,
+		Name:    "add_expiry_to_qr_token",
+		Up: []string{
+			`ALTER TABLE qr_token
+				ADD COLUMN issued_at DATETIME NULL DEFAULT NULL COMMENT '発行日時' AFTER qr_token,
+				ADD COLUMN expires_at DATETIME NULL DEFAULT NULL COMMENT '有効期限' AFTER issued_at`,
+			// 有効期限のない既存のトークンは期限切れとし、次回の取得時に新しいトークンを発行する
+			`UPDATE qr_token SET issued_at = created_at, expires_at = created_at`,
+			`ALTER TABLE qr_token
+				MODIFY COLUMN issued_at DATETIME NOT NULL COMMENT '発行日時',
+				MODIFY COLUMN expires_at DATETIME NOT NULL COMMENT '有効期限'`,
+		},
+		Down: []string{
+			`ALTER TABLE qr_token DROP COLUMN expires_at, DROP COLUMN issued_at`,
+		},
+		// SQLiteは列の定義を変更できないため、NULL許容のままとする
+		SQLite: []string{
+			`ALTER TABLE qr_token ADD COLUMN issued_at DATETIME NULL DEFAULT NULL`,
+			`ALTER TABLE qr_token ADD COLUMN expires_at DATETIME NULL DEFAULT NULL`,
+			`UPDATE qr_token SET issued_at = created_at, expires_at = created_at`,
+		},
+	},
+	{
+		Version: 15,
+		Name:    "add_jti_to_qr_token",
+		Up: []string{
+			`ALTER TABLE qr_token
+				ADD COLUMN jti VARCHAR(32) NOT NULL DEFAULT '' COMMENT 'トークンごとの一意なID（JWTのjti）' AFTER qr_token,
+				ADD COLUMN use_count INT NOT NULL DEFAULT 0 COMMENT '顔認証に成功した回数' AFTER expires_at`,
+			`ALTER TABLE face_recognition_result
+				ADD COLUMN qr_token_jti VARCHAR(32) NOT NULL DEFAULT '' COMMENT '顔認証に使ったQRトークンのjti' AFTER location`,
+		},
+		Down: []string{
+			`ALTER TABLE face_recognition_result DROP COLUMN qr_token_jti`,
+			`ALTER TABLE qr_token DROP COLUMN use_count, DROP COLUMN jti`,
+		},
+		SQLite: []string{
+			`ALTER TABLE qr_token ADD COLUMN jti VARCHAR(32) NOT NULL DEFAULT ''`,
+			`ALTER TABLE qr_token ADD COLUMN use_count INT NOT NULL DEFAULT 0`,
+			`ALTER TABLE face_recognition_result ADD COLUMN qr_token_jti VARCHAR(32) NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version: 16,
+		Name:    "widen_qr_token",
+		Up: []string{
+			// 鍵ID・jtiなどのクレームを追加してもトークンが収まるようにする
+			`ALTER TABLE qr_token MODIFY COLUMN qr_token VARCHAR(1024) NOT NULL COMMENT 'QRトークン'`,
+		},
+		Down: []string{
+			`ALTER TABLE qr_token MODIFY COLUMN qr_token VARCHAR(255) NOT NULL COMMENT 'QRトークン'`,
+		},
+		// SQLiteはVARCHARの長さを制限しないため、変更は不要
+		SQLite: []string{},
+	},
+	{
+		Version: 17,
+		Name:    "add_location_to_mst_user",
+		Up: []string{
+			// 顔認証の設置場所はリクエストではなく端末のユーザに設定した値を使う
+			`ALTER TABLE mst_user ADD COLUMN location VARCHAR(64) NOT NULL DEFAULT '' COMMENT '顔認証端末（kioskロール）の設置場所' AFTER status`,
+		},
+		Down: []string{
+			`ALTER TABLE mst_user DROP COLUMN location`,
+		},
+		SQLite: []string{
+			`ALTER TABLE mst_user ADD COLUMN location VARCHAR(64) NOT NULL DEFAULT ''`,
+		},
+	},
+}
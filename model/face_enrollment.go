@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+)
+
+// 顔写真の登録履歴（写真を追加・登録し直すたびに版数を上げて追加し、利用中のものすべてと顔認証で比較する）
+type FaceEnrollment struct {
+	Id            float64    `json:"id"`
+	MstUserId     float64    `json:"mstUserId"`
+	Version       int        `json:"version"`
+	Label         string     `json:"label"`
+	Photo         string     `json:"photo"`
+	S3Key         string     `json:"s3Key"`
+	FaceId        string     `json:"-"` // 顔検索の索引上の顔ID（未登録・索引から削除済みなら空）
+	Active        bool       `json:"active"`
+	DeactivatedAt *time.Time `json:"deactivatedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"-"`
+}
+
+func (FaceEnrollment) TableName() string {
+	return "face_enrollment"
+}
+
+// 顔写真再登録・追加APIのRequestBody
+type PhotoParams struct {
+	Photo string `json:"photo" validate:"required,base64"`
+	Label string `json:"label" validate:"max=32"`
+}
+
+// 顔写真を登録できない理由
+type QualityReason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// 顔写真を登録できない理由のコード
+const (
+	QualityNoFaceDetected = "no_face_detected"
+	QualityMultipleFaces  = "multiple_faces"
+	QualityFaceTooSmall   = "face_too_small"
+	QualityTooBlurry      = "too_blurry"
+	QualityEyesClosed     = "eyes_closed"
+	QualityExtremePose    = "extreme_pose"
+)
@@ -6,15 +6,70 @@ type FaceRecognitionResult struct {
 	Id               float64 `json:"id"`
 	MstUser          MstUser `gorm:"foreignkey:MstUserId" json:"mstUser"`
 	MstUserId        float64 `json:"mstUserId"`
+	// 比較した顔写真の登録履歴
+	FaceEnrollmentId *float64 `json:"faceEnrollmentId,omitempty"`
+	// 認証方式
+	Method           string  `json:"method"`
+	// 設置場所（指定がなければ空）
+	Location         string  `json:"location"`
+	// 顔認証に使ったQRトークンのjti（顔識別の場合は空）
+	QrTokenJti string `json:"qrTokenJti"`
+	// 顔認証に使ったライブネスチャレンジ（チャレンジなしの場合はnull）
+	LivenessChallengeId *float64 `json:"livenessChallengeId,omitempty"`
 	SourceImage      string  `json:"sourceImage"`
 	SourceImageS3Key string  `json:"sourceImageS3Key"`
 	TargetImage      string  `json:"targetImage"`
 	TargetImageS3Key string  `json:"targetImageS3Key"`
+	// 類似度（0-100）
 	Result           float64 `json:"result"`
+	// なりすましスコア（0-100、検知しない場合はnull）
+	SpoofScore *float64 `json:"spoofScore,omitempty"`
+	// 判定に使ったしきい値とその適用元（default / location / user）
+	AcceptThreshold  float64 `json:"acceptThreshold"`
+	ReviewThreshold  float64 `json:"reviewThreshold"`
+	ThresholdScope   string  `json:"thresholdScope"`
+	// 判定（accept / review / reject）
+	Decision         string  `json:"decision"`
+	// 結果の種類（顔が検出できない等で比較できなかった場合も記録する）
+	Outcome          string  `json:"outcome"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"-"`
 }
 
+// 認証方式
+const (
+	// QRトークンで特定したユーザの顔写真と比較（1:1）
+	RecognitionMethodQrToken = "qr_token"
+	// 登録済みのすべての顔写真から検索（1:N）
+	RecognitionMethodIdentification = "identification"
+)
+
+// 顔認証結果の種類
+const (
+	// 本人と判定
+	OutcomeMatched = "matched"
+	// 本人と判定しなかった（要確認を含む）
+	OutcomeNotMatched = "not_matched"
+	// 撮影した写真に顔が写っていない
+	OutcomeNoFaceDetected = "no_face_detected"
+	// 撮影した写真に複数の顔が写っている
+	OutcomeMultipleFaces = "multiple_faces"
+	// 顔が小さい・不鮮明などで比較に適さない
+	OutcomeLowQuality = "low_quality"
+	// 顔照合エンジンのエラー
+	OutcomeBackendError = "backend_error"
+	// ライブネスチャレンジの動作を確認できなかった（写真を提示した可能性がある）
+	OutcomeLivenessFailed = "liveness_failed"
+	// なりすまし（画面・印刷物の再撮影）の疑いがある
+	OutcomeSpoofSuspected = "spoof_suspected"
+)
+
 func (FaceRecognitionResult) TableName() string {
 	return "face_recognition_result"
-}
\ No newline at end of file
+}
+// 顔識別（1:N）APIのRequestBody
+type FaceIdentificationParams struct {
+	Photo    string `json:"photo" validate:"required,base64"`
+	// 設置場所（省略可。端末に設定した設置場所と異なる場合はエラーとする）
+	Location string `json:"location" validate:"max=64"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// ライブネスチャレンジ（顔認証の前に端末へ発行し、1回の顔認証にのみ使える）
+type LivenessChallenge struct {
+	Id          float64 `json:"-"`
+	ChallengeId string  `json:"challengeId"`
+	// チャレンジを発行した端末（キオスク）のユーザ
+	MstUserId float64 `json:"-"`
+	// 求める動作（順番どおりにカンマ区切りで保存する）
+	Steps     string     `json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+	UpdatedAt time.Time  `json:"-"`
+}
+
+func (LivenessChallenge) TableName() string {
+	return "liveness_challenge"
+}
+
+// 求める動作の一覧
+func (c LivenessChallenge) StepList() []string {
+	return strings.Split(c.Steps, ",")
+}
+
+// ライブネスチャレンジで求める動作
+const (
+	LivenessStepTurnLeft  = "turn_left"
+	LivenessStepTurnRight = "turn_right"
+	LivenessStepLookUp    = "look_up"
+	LivenessStepLookDown  = "look_down"
+	LivenessStepBlink     = "blink"
+)
+
+// チャレンジに使う動作
+var LivenessSteps = []string{
+	LivenessStepTurnLeft,
+	LivenessStepTurnRight,
+	LivenessStepLookUp,
+	LivenessStepLookDown,
+	LivenessStepBlink,
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+// 設置場所ごとの判定しきい値（全体のデフォルトより優先し、ユーザ個別の設定よりは優先しない）
+type LocationThreshold struct {
+	Id              float64   `json:"id"`
+	Location        string    `json:"location"`
+	AcceptThreshold float64   `json:"acceptThreshold"`
+	ReviewThreshold float64   `json:"reviewThreshold"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"-"`
+}
+
+func (LocationThreshold) TableName() string {
+	return "location_threshold"
+}
+
+// 判定しきい値設定APIのRequestBody
+type ThresholdParams struct {
+	AcceptThreshold *float64 `json:"acceptThreshold" validate:"required,min=0,max=100"`
+	ReviewThreshold *float64 `json:"reviewThreshold" validate:"required,min=0,max=100"`
+}
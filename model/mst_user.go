@@ -14,9 +14,31 @@ type MstUser struct {
 	Photo       string `json:"photo"`
 	S3Key       string `json:"s3Key"`
 	IsAdmin     bool   `json:"isAdmin"`
+	// ロール（admin、operator、kiosk、member）。IsAdminはadminロールと同期する
+	Role        string `json:"role"`
+	// 状態（active、suspended）。停止中はログイン・顔認証できない
+	Status      string `json:"status"`
+	// 顔認証端末（kioskロール）の設置場所。顔認証では端末の設置場所の判定しきい値を適用する
+	Location    string `json:"location"`
+	// 判定しきい値の個別設定（未設定なら設置場所・全体の設定に従う）
+	AcceptThreshold *float64 `json:"acceptThreshold,omitempty"`
+	ReviewThreshold *float64 `json:"reviewThreshold,omitempty"`
 	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"-"`
+	// 論理削除（GORMが検索条件にdeleted_at IS NULLを付与する）
+	DeletedAt   *time.Time `json:"deletedAt,omitempty"`
+}
+
+// ユーザの状態
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+)
+
+// 利用可能なユーザか
+func (u MstUser) Active() bool {
+	return u.Status == UserStatusActive
 }
 
 // GORMではテーブル名が複数形になってしまうため、実テーブル名を明示する
@@ -37,3 +59,54 @@ type UserParams struct {
 	Password string `json:"password" validate:"required"`
 	Photo    string `json:"photo" validate:"required,base64"`
 }
+
+// ロール変更APIのRequestBody
+type RoleParams struct {
+	Role string `json:"role" validate:"required"`
+}
+
+// 端末の設置場所設定APIのRequestBody（空文字なら設置場所を解除する）
+type LocationParams struct {
+	Location string `json:"location" validate:"max=64"`
+}
+
+// ユーザ更新APIのRequestBody（指定した項目のみ更新する）
+type UserUpdateParams struct {
+	Email    *string `json:"email" validate:"omitempty,email"`
+	Username *string `json:"username" validate:"omitempty,min=1,max=16"`
+	Status   *string `json:"status" validate:"omitempty,oneof=active suspended"`
+}
+
+// 自身のユーザ情報更新APIのRequestBody（メールアドレス・パスワードの変更には現在のパスワードが必要）
+type ProfileUpdateParams struct {
+	Email           *string `json:"email" validate:"omitempty,email"`
+	Username        *string `json:"username" validate:"omitempty,min=1,max=16"`
+	Password        *string `json:"password" validate:"omitempty,min=1"`
+	CurrentPassword string  `json:"currentPassword"`
+}
+
+// ユーザ一覧取得APIのクエリパラメータ
+type UserListParams struct {
+	// ページ番号（1始まり）と1ページあたりの件数
+	Page    int `query:"page" validate:"omitempty,min=1"`
+	PerPage int `query:"perPage" validate:"omitempty,min=1,max=100"`
+	// メールアドレス・ユーザ名の部分一致
+	Email    string `query:"email"`
+	Username string `query:"username"`
+	Admin    string `query:"admin" validate:"omitempty,oneof=true false"`
+	Status   string `query:"status" validate:"omitempty,oneof=active suspended"`
+	// 作成日時の範囲（RFC3339。createdFrom以上、createdTo未満）
+	CreatedFrom string `query:"createdFrom"`
+	CreatedTo   string `query:"createdTo"`
+	// 並び順（カンマ区切り。先頭に-を付けると降順。例：-createdAt,email）
+	Sort string `query:"sort"`
+}
+
+// ユーザ一覧取得APIのレスポンス
+type UserList struct {
+	Items      []MstUser `json:"items"`
+	Total      int       `json:"total"`
+	Page       int       `json:"page"`
+	PerPage    int       `json:"perPage"`
+	TotalPages int       `json:"totalPages"`
+}
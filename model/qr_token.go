@@ -9,6 +9,12 @@ type QrToken struct {
 	MstUser     MstUser   `gorm:"foreignkey:MstUserId" json:"mstUser"`
 	MstUserId   float64   `json:"mstUserId"`
 	QrToken     string    `json:"qrToken"`
+	// 発行日時と有効期限（ローテーションの間隔を過ぎると新しいトークンに置き換える）
+	IssuedAt    time.Time `json:"issuedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	// トークンごとの一意なID（JWTのjti）と、顔認証に成功した回数
+	Jti         string    `json:"-"`
+	UseCount    int       `json:"-"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"-"`
 }
@@ -17,8 +23,23 @@ func (QrToken) TableName() string {
 	return "qr_token"
 }
 
+// 有効期限内のトークンか
+func (t QrToken) Active(now time.Time) bool {
+	return now.Before(t.ExpiresAt)
+}
+
+// 利用できる回数まで顔認証に成功したトークンか（maxUsesが0なら回数を制限しない）
+func (t QrToken) UsedUp(maxUses int) bool {
+	return maxUses > 0 && t.UseCount >= maxUses
+}
+
 // 顔認証APIのRequestBody
 type FaceRecognitionParams struct {
 	QrToken  string `json:"qrToken" validate:"required"`
 	Photo    string `json:"photo" validate:"required,base64"`
+	// 設置場所（省略可。端末に設定した設置場所と異なる場合はエラーとする）
+	Location string `json:"location" validate:"max=64"`
+	// ライブネスチャレンジのIDと、チャレンジの動作を撮影した連続フレーム（base64）
+	ChallengeId string   `json:"challengeId" validate:"max=32"`
+	Frames      []string `json:"frames" validate:"max=10,dive,required,base64"`
 }
\ No newline at end of file
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+)
+
+// ログインセッション（リフレッシュトークンごとに1レコード）
+type UserSession struct {
+	Id        float64 `json:"-"`
+	SessionId string  `json:"id"`
+	MstUserId float64 `json:"-"`
+	// リフレッシュトークンは平文で保存せず、ハッシュ値のみ保存する
+	RefreshTokenHash string     `json:"-"`
+	UserAgent        string     `json:"userAgent"`
+	IpAddress        string     `json:"ipAddress"`
+	ExpiresAt        time.Time  `json:"expiresAt"`
+	LastUsedAt       *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt        *time.Time `json:"-"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"-"`
+	// リクエストしたアクセストークンのセッションか（テーブルには保存しない）
+	Current bool `gorm:"-" json:"current"`
+}
+
+func (UserSession) TableName() string {
+	return "user_session"
+}
+
+// 有効なセッションか（失効・期限切れでない）
+func (s UserSession) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// トークン更新APIのRequestBody
+type RefreshParams struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"errors"
+)
+
+// 顔照合結果の判定
+type Decision string
+
+const (
+	// 本人と判定（認証成功）
+	DecisionAccept Decision = "accept"
+	// 要確認（自動では認証せず、運用担当者の確認に回す）
+	DecisionReview Decision = "review"
+	// 本人ではないと判定
+	DecisionReject Decision = "reject"
+)
+
+// 判定のしきい値（類似度：0-100）
+// Accept以上は本人、Review以上Accept未満は要確認、Review未満は本人ではない
+type Thresholds struct {
+	Accept float64 `json:"acceptThreshold"`
+	Review float64 `json:"reviewThreshold"`
+}
+
+// しきい値の範囲と大小関係の検証
+func (t Thresholds) Validate() error {
+	if t.Accept < 0 || t.Accept > 100 || t.Review < 0 || t.Review > 100 {
+		return errors.New("しきい値は0〜100で指定してください")
+	}
+	// 0では類似度0（顔を比較できなかった場合を含む）も本人と判定してしまう
+	if t.Accept <= 0 {
+		return errors.New("本人と判定するしきい値は0より大きい値で指定してください")
+	}
+	if t.Review > t.Accept {
+		return errors.New("要確認のしきい値は本人と判定するしきい値以下で指定してください")
+	}
+	return nil
+}
+
+// 類似度を判定する
+func (t Thresholds) Decide(similarity float64) Decision {
+	switch {
+	case similarity >= t.Accept:
+		return DecisionAccept
+	case similarity >= t.Review:
+		return DecisionReview
+	default:
+		return DecisionReject
+	}
+}
+
+// しきい値の適用元
+type Scope string
+
+const (
+	ScopeDefault  Scope = "default"
+	ScopeLocation Scope = "location"
+	ScopeUser     Scope = "user"
+)
+
+// 判定ポリシー
+// ユーザ個別の設定 > 設置場所ごとの設定 > 全体のデフォルトの順に優先する
+type Policy struct {
+	Default Thresholds
+}
+
+// 適用するしきい値を決める（個別の設定がなければnilを渡す）
+func (p Policy) Resolve(location *Thresholds, user *Thresholds) (Thresholds, Scope) {
+	if user != nil {
+		return *user, ScopeUser
+	}
+	if location != nil {
+		return *location, ScopeLocation
+	}
+	return p.Default, ScopeDefault
+}
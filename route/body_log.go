@@ -0,0 +1,115 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"face-recognition/textutil"
+	"fmt"
+	"github.com/labstack/echo"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"strings"
+)
+
+// マスクした値の表記
+const redacted = "[REDACTED]"
+
+// リクエストボディのログ出力設定
+type BodyLogConfig struct {
+	// falseならリクエストボディを出力しない
+	Enabled bool
+	// 出力する最大バイト数（超えた分は切り詰める。0なら無制限）
+	MaxBytes int
+	// 値をマスクするJSONのフィールド名（大文字・小文字は区別しない）
+	RedactFields []string
+	// 出力しないルート（"POST /api/v1/face-recognition"の形式。パスはルーティング定義のもの）
+	ExcludeRoutes []string
+	// 出力先（未指定ならサーバのロガー）
+	Logger *zap.Logger
+}
+
+// デフォルトのリクエストボディのログ出力設定（パスワード・顔写真・トークンはマスクする）
+var DefaultBodyLogConfig = BodyLogConfig{
+	Enabled:      true,
+	MaxBytes:     1024,
+	RedactFields: []string{"password", "photo", "frames", "qrToken", "refreshToken"},
+}
+
+// リクエストボディをログ出力するミドルウェア
+// JSONは指定したフィールドをマスクしてから出力し、JSON以外は内容を出力せずサイズのみ出力する
+func BodyLog(config BodyLogConfig) echo.MiddlewareFunc {
+	redactFields := map[string]bool{}
+	for _, f := range config.RedactFields {
+		redactFields[strings.ToLower(f)] = true
+	}
+	excludeRoutes := map[string]bool{}
+	for _, r := range config.ExcludeRoutes {
+		excludeRoutes[strings.Join(strings.Fields(r), " ")] = true
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if !config.Enabled || req.Body == nil || excludeRoutes[req.Method+" "+c.Path()] {
+				return next(c)
+			}
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return err
+			}
+			// ハンドラでも読み込めるように戻す
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			if len(body) > 0 {
+				config.Logger.Info("Request Body",
+					zap.String("method", req.Method),
+					zap.String("path", c.Path()),
+					zap.Int("size", len(body)),
+					zap.String("パラメータ", truncate(redactBody(body, redactFields), config.MaxBytes)),
+				)
+			}
+			return next(c)
+		}
+	}
+}
+
+// JSONの指定フィールドをマスク（入れ子のオブジェクト・配列も対象）
+func redactBody(body []byte, fields map[string]bool) string {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		// フォーム送信などはマスクできないため、内容は出力しない
+		return fmt.Sprintf("[non-JSON body: %d bytes]", len(body))
+	}
+	data, err := json.Marshal(redactValue(value, fields))
+	if err != nil {
+		return fmt.Sprintf("[non-JSON body: %d bytes]", len(body))
+	}
+	return string(data)
+}
+
+func redactValue(value interface{}, fields map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if fields[strings.ToLower(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(child, fields)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(child, fields)
+		}
+	}
+	return value
+}
+
+// 最大バイト数で切り詰め、切り詰めたバイト数を付記する
+func truncate(s string, maxBytes int) string {
+	cut := textutil.Truncate(s, maxBytes)
+	if len(cut) == len(s) {
+		return s
+	}
+	return fmt.Sprintf("%s...(truncated %d bytes)", cut, len(s)-len(cut))
+}
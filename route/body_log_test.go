@@ -0,0 +1,90 @@
+package route
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// リクエストボディのログ出力を記録するサーバ
+func newBodyLogTestServer(t *testing.T, config BodyLogConfig) (*testServer, *observer.ObservedLogs) {
+	t.Helper()
+	ts := newTestServer(t)
+	core, logs := observer.New(zapcore.InfoLevel)
+	config.Logger = zap.New(core)
+	ts.echo = Init(ts.server, config)
+	return ts, logs
+}
+
+func bodyLogs(logs *observer.ObservedLogs) []string {
+	var bodies []string
+	for _, entry := range logs.FilterMessage("Request Body").All() {
+		bodies = append(bodies, entry.ContextMap()["パラメータ"].(string))
+	}
+	return bodies
+}
+
+func TestBodyLogRedaction(t *testing.T) {
+	ts, logs := newBodyLogTestServer(t, DefaultBodyLogConfig)
+	photo := fixturePhoto(t, "match.png")
+	ts.register("test1@test.co.jp", photo)
+	ts.login("test1@test.co.jp")
+
+	bodies := bodyLogs(logs)
+	if len(bodies) != 2 {
+		t.Fatalf("ログの件数: got %v", bodies)
+	}
+	for _, body := range bodies {
+		if strings.Contains(body, "Password123") || strings.Contains(body, photo[:32]) {
+			t.Errorf("マスクされていない: %s", body)
+		}
+		if !strings.Contains(body, `"password":"[REDACTED]"`) || !strings.Contains(body, "test1@test.co.jp") {
+			t.Errorf("マスク結果が不正: %s", body)
+		}
+	}
+}
+
+func TestBodyLogTruncate(t *testing.T) {
+	config := DefaultBodyLogConfig
+	config.RedactFields = nil
+	config.MaxBytes = 64
+	ts, logs := newBodyLogTestServer(t, config)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+
+	bodies := bodyLogs(logs)
+	if len(bodies) != 1 {
+		t.Fatalf("ログの件数: got %v", bodies)
+	}
+	if !strings.HasSuffix(bodies[0], "bytes)") || len(bodies[0]) > 64+len("...(truncated 0000 bytes)") {
+		t.Errorf("切り詰められていない: %s", bodies[0])
+	}
+}
+
+func TestBodyLogExcludeRoutes(t *testing.T) {
+	config := DefaultBodyLogConfig
+	config.ExcludeRoutes = []string{"POST /api/v1/users/register"}
+	ts, logs := newBodyLogTestServer(t, config)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.login("test1@test.co.jp")
+
+	bodies := bodyLogs(logs)
+	if len(bodies) != 1 || !strings.Contains(bodies[0], "test1@test.co.jp") {
+		t.Errorf("除外したルート以外のみ出力されること: got %v", bodies)
+	}
+}
+
+func TestBodyLogNonJSON(t *testing.T) {
+	ts, logs := newBodyLogTestServer(t, DefaultBodyLogConfig)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/login", strings.NewReader("email=test1%40test.co.jp&password=Password123"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ts.echo.ServeHTTP(httptest.NewRecorder(), req)
+
+	bodies := bodyLogs(logs)
+	if len(bodies) != 1 || bodies[0] != "[non-JSON body: 45 bytes]" {
+		t.Errorf("JSON以外はサイズのみ出力されること: got %v", bodies)
+	}
+}
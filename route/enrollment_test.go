@@ -0,0 +1,259 @@
+package route
+
+import (
+	"face-recognition/auth"
+	"face-recognition/model"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// 顔写真の登録履歴を取得
+func (ts *testServer) enrollments(path string, token string) []model.FaceEnrollment {
+	ts.t.Helper()
+	rec := ts.request(http.MethodGet, path, token, nil)
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("登録履歴: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	var enrollments []model.FaceEnrollment
+	decode(ts.t, rec, &enrollments)
+	return enrollments
+}
+
+func TestReplacePhoto(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	token := ts.login("test1@test.co.jp")
+	kiosk := ts.kiosk()
+
+	// 登録時の写真が1版目になる
+	enrollments := ts.enrollments("/api/v1/users/me/enrollments", token)
+	if len(enrollments) != 1 || enrollments[0].Version != 1 || !enrollments[0].Active {
+		t.Fatalf("登録時の履歴: got %+v", enrollments)
+	}
+
+	rec := ts.request(http.MethodPut, "/api/v1/users/me/photo", token, map[string]string{"photo": fixturePhoto(t, "match.png")})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	var enrollment model.FaceEnrollment
+	decode(t, rec, &enrollment)
+	if enrollment.Version != 2 || !enrollment.Active {
+		t.Errorf("再登録した写真: got %+v", enrollment)
+	}
+
+	// 以前の写真は履歴として残り、新しい写真のみ利用中になる
+	enrollments = ts.enrollments("/api/v1/users/me/enrollments", token)
+	if len(enrollments) != 2 {
+		t.Fatalf("履歴の件数: got %d, want 2", len(enrollments))
+	}
+	if enrollments[0].Id != enrollment.Id || !enrollments[0].Active {
+		t.Errorf("最新の版: got %+v", enrollments[0])
+	}
+	if enrollments[1].Version != 1 || enrollments[1].Active || enrollments[1].DeactivatedAt == nil {
+		t.Errorf("以前の版: got %+v", enrollments[1])
+	}
+	if _, err := ts.store.Get(enrollments[1].S3Key); err != nil {
+		t.Errorf("以前の画像が削除された: %v", err)
+	}
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	if user.S3Key != enrollment.S3Key {
+		t.Errorf("ユーザの写真: got %s, want %s", user.S3Key, enrollment.S3Key)
+	}
+
+	// 顔認証には新しい写真を利用し、利用した写真を記録する
+	for _, tt := range []struct {
+		photo string
+		want  bool
+	}{
+		{photo: "match.png", want: true},
+		{photo: "mismatch.png", want: false},
+	} {
+		rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+			"qrToken": ts.qrToken(token),
+			"photo":   fixturePhoto(t, tt.photo),
+		})
+		var res struct {
+			AuthResult bool `json:"authResult"`
+		}
+		decode(t, rec, &res)
+		if res.AuthResult != tt.want {
+			t.Errorf("%s: 認証結果: got %v, want %v", tt.photo, res.AuthResult, tt.want)
+		}
+	}
+	var results []model.FaceRecognitionResult
+	ts.server.DB.Find(&results)
+	for _, result := range results {
+		if result.FaceEnrollmentId == nil || *result.FaceEnrollmentId != enrollment.Id {
+			t.Errorf("利用した写真: got %v, want %v", result.FaceEnrollmentId, enrollment.Id)
+		}
+		if result.SourceImageS3Key != enrollment.S3Key {
+			t.Errorf("比較元画像: got %s, want %s", result.SourceImageS3Key, enrollment.S3Key)
+		}
+	}
+}
+
+func TestReplaceUserPhoto(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+	admin := ts.login("admin@test.co.jp")
+	member := ts.login("test1@test.co.jp")
+	path := ts.userPath("test1@test.co.jp")
+	photo := map[string]string{"photo": fixturePhoto(t, "mismatch.png")}
+
+	if rec := ts.request(http.MethodPut, ts.userPath("admin@test.co.jp")+"/photo", member, photo); rec.Code != http.StatusForbidden {
+		t.Errorf("一般ユーザによる再登録: ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := ts.request(http.MethodGet, path+"/enrollments", member, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("一般ユーザによる履歴の参照: ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := ts.request(http.MethodPut, "/api/v1/users/9999/photo", admin, photo); rec.Code != http.StatusNotFound {
+		t.Errorf("存在しないユーザ: ステータスコード: got %d", rec.Code)
+	}
+	if rec := ts.request(http.MethodPut, path+"/photo", admin, photo); rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	enrollments := ts.enrollments(path+"/enrollments", admin)
+	if len(enrollments) != 2 || enrollments[0].Version != 2 || !enrollments[0].Active {
+		t.Errorf("履歴: got %+v", enrollments)
+	}
+}
+
+func TestReplacePhotoValidation(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+
+	rec := ts.request(http.MethodPut, "/api/v1/users/me/photo", token, map[string]string{})
+	assertMessages(t, rec, []string{"写真は必須項目です"})
+	rec = ts.request(http.MethodPut, "/api/v1/users/me/photo", token, map[string]string{"photo": "@@@"})
+	assertMessages(t, rec, []string{"写真のフォーマットが不正です"})
+	if enrollments := ts.enrollments("/api/v1/users/me/enrollments", token); len(enrollments) != 1 {
+		t.Errorf("履歴の件数: got %d, want 1", len(enrollments))
+	}
+}
+
+func TestMultipleEnrollments(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	token := ts.login("test1@test.co.jp")
+	kiosk := ts.kiosk()
+	recognize := func(photo string) bool {
+		t.Helper()
+		rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+			"qrToken": ts.qrToken(token),
+			"photo":   fixturePhoto(t, photo),
+		})
+		var res struct {
+			AuthResult bool `json:"authResult"`
+		}
+		decode(t, rec, &res)
+		return res.AuthResult
+	}
+	if recognize("match.png") {
+		t.Fatal("追加前に一致した")
+	}
+
+	rec := ts.request(http.MethodPost, "/api/v1/users/me/enrollments", token, map[string]string{
+		"photo": fixturePhoto(t, "match.png"),
+		"label": "眼鏡あり",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	var added model.FaceEnrollment
+	decode(t, rec, &added)
+	if added.Version != 2 || added.Label != "眼鏡あり" || !added.Active {
+		t.Errorf("追加した写真: got %+v", added)
+	}
+	// 追加しても以前の写真は利用中のまま
+	enrollments := ts.enrollments("/api/v1/users/me/enrollments", token)
+	if len(enrollments) != 2 || !enrollments[0].Active || !enrollments[1].Active {
+		t.Fatalf("登録履歴: got %+v", enrollments)
+	}
+	first := enrollments[1]
+
+	// 利用中のすべての写真と比較し、最も類似度の高い写真を記録する
+	ts.matcher.SetSimilarity(first.S3Key, "sha256:0fdd48c5f8baa6978f70b75a44ae207cb8df6c801e1b17a2d2e072d767a040a2", 91)
+	for _, tt := range []struct {
+		photo      string
+		enrollment float64
+	}{
+		{photo: "match.png", enrollment: added.Id},
+		{photo: "mismatch.png", enrollment: first.Id},
+	} {
+		if !recognize(tt.photo) {
+			t.Errorf("%s: 一致しなかった", tt.photo)
+		}
+		result := model.FaceRecognitionResult{}
+		ts.server.DB.Order("id DESC").First(&result)
+		if result.FaceEnrollmentId == nil || *result.FaceEnrollmentId != tt.enrollment {
+			t.Errorf("%s: 一致した写真: got %v, want %v", tt.photo, result.FaceEnrollmentId, tt.enrollment)
+		}
+	}
+
+	// 利用終了にした写真とは比較しない
+	path := "/api/v1/users/me/enrollments/" + strconv.FormatFloat(added.Id, 'f', -1, 64)
+	if rec := ts.request(http.MethodDelete, path, token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("利用終了: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	if rec := ts.request(http.MethodDelete, path, token, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("利用終了済み: ステータスコード: got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if recognize("match.png") {
+		t.Error("利用終了にした写真と一致した")
+	}
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	if user.S3Key != first.S3Key {
+		t.Errorf("ユーザの写真: got %s, want %s", user.S3Key, first.S3Key)
+	}
+	// 最後の1枚は利用終了にできない
+	rec = ts.request(http.MethodDelete, "/api/v1/users/me/enrollments/"+strconv.FormatFloat(first.Id, 'f', -1, 64), token, nil)
+	assertMessages(t, rec, []string{"利用中の最後の顔写真は削除できません"})
+}
+
+func TestEnrollmentLimit(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("test2@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+	photo := map[string]string{"photo": fixturePhoto(t, "mismatch.png")}
+
+	for i := 0; i < 4; i++ {
+		if rec := ts.request(http.MethodPost, "/api/v1/users/me/enrollments", token, photo); rec.Code != http.StatusOK {
+			t.Fatalf("%d枚目: ステータスコード: got %d (%s)", i+2, rec.Code, rec.Body.String())
+		}
+	}
+	rec := ts.request(http.MethodPost, "/api/v1/users/me/enrollments", token, photo)
+	assertMessages(t, rec, []string{"顔写真は5枚まで登録できます"})
+	rec = ts.request(http.MethodPost, "/api/v1/users/me/enrollments", token, map[string]string{
+		"photo": "@@@",
+		"label": "123456789012345678901234567890123",
+	})
+	assertMessages(t, rec, []string{"写真のフォーマットが不正です", "ラベルは32文字以内で入力してください"})
+
+	// 再登録すると利用中の写真はすべて置き換わる
+	if rec := ts.request(http.MethodPut, "/api/v1/users/me/photo", token, photo); rec.Code != http.StatusOK {
+		t.Fatalf("再登録: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	active := 0
+	for _, e := range ts.enrollments("/api/v1/users/me/enrollments", token) {
+		if e.Active {
+			active++
+		}
+	}
+	if active != 1 {
+		t.Errorf("利用中の写真の数: got %d, want 1", active)
+	}
+	// 他のユーザの写真は利用終了にできない
+	other := model.FaceEnrollment{}
+	ts.server.DB.Where("mst_user_id <> (SELECT id FROM mst_user WHERE email = ?)", "test1@test.co.jp").First(&other)
+	rec = ts.request(http.MethodDelete, "/api/v1/users/me/enrollments/"+strconv.FormatFloat(other.Id, 'f', -1, 64), token, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("他のユーザの写真: ステータスコード: got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,192 @@
+package route
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"face-recognition/api"
+	"face-recognition/auth"
+	"face-recognition/matcher"
+	"face-recognition/migration"
+	"face-recognition/model"
+	"face-recognition/storage"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/labstack/echo"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testSessionKey = "test-session-key"
+	testQrKey      = "test-qr-key"
+)
+
+// テスト用のサーバ（SQLite・メモリ上のストレージ・ローカル顔照合エンジン）
+type testServer struct {
+	t       *testing.T
+	echo    *echo.Echo
+	server  *api.Server
+	matcher *matcher.FakeMatcher
+	store   *storage.MemoryStore
+	now     time.Time
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "face-recognition-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db")+"?_busy_timeout=5000&_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migration.New(db, migration.Migrations).Up(); err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{
+		t:       t,
+		matcher: matcher.NewFakeMatcher(nil),
+		store:   storage.NewMemoryStore(),
+		now:     time.Now(),
+	}
+	sessionKeys, err := auth.NewKeyring(auth.Key{Id: "session-1", Secret: []byte(testSessionKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qrKeys, err := auth.NewKeyring(auth.Key{Id: "qr-1", Secret: []byte(testQrKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.server = api.NewServer(db, ts.store, ts.matcher, sessionKeys, qrKeys)
+	ts.server.Clock = func() time.Time { return ts.now }
+	ts.echo = Init(ts.server, DefaultBodyLogConfig)
+	return ts
+}
+
+// JSONリクエストを送信（tokenが空でなければAuthorizationヘッダを付与する）
+func (ts *testServer) request(method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		data, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	ts.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+// ユーザ登録
+func (ts *testServer) register(email string, photo string) {
+	ts.t.Helper()
+	rec := ts.request(http.MethodPost, "/api/v1/users/register", "", map[string]string{
+		"email":    email,
+		"username": "テスト太郎",
+		"password": "Password123",
+		"photo":    photo,
+	})
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("ユーザ登録失敗: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// ログインしてアクセストークンを取得
+func (ts *testServer) login(email string) string {
+	ts.t.Helper()
+	rec := ts.request(http.MethodPost, "/api/v1/users/login", "", map[string]string{
+		"email":    email,
+		"password": "Password123",
+	})
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("ログイン失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var res struct {
+		Token string `json:"token"`
+	}
+	decode(ts.t, rec, &res)
+	return res.Token
+}
+
+// ロールを変更（管理者APIを経由せずに直接更新する）
+func (ts *testServer) setRole(email string, role auth.Role) {
+	ts.t.Helper()
+	err := ts.server.DB.Model(&model.MstUser{}).Where("email = ?", email).Updates(map[string]interface{}{
+		"role":     string(role),
+		"is_admin": role == auth.RoleAdmin,
+	}).Error
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+// 顔認証端末のユーザを登録してログイン
+func (ts *testServer) kiosk() string {
+	ts.t.Helper()
+	ts.register("kiosk@test.co.jp", fixturePhoto(ts.t, "no_face.png"))
+	ts.setRole("kiosk@test.co.jp", auth.RoleKiosk)
+	return ts.login("kiosk@test.co.jp")
+}
+
+// QRトークン取得
+func (ts *testServer) qrToken(token string) string {
+	ts.t.Helper()
+	rec := ts.request(http.MethodGet, "/api/v1/qr-token", token, nil)
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("QRトークン取得失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var res struct {
+		QrToken string `json:"qrToken"`
+	}
+	decode(ts.t, rec, &res)
+	return res.QrToken
+}
+
+// fixtures/imagesの画像をbase64形式で読み込む
+func fixturePhoto(t *testing.T, name string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("..", "fixtures", "images", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("レスポンスのデコード失敗: %v %s", err, rec.Body.String())
+	}
+}
+
+// バリデーションエラーのメッセージ一覧を検証
+func assertMessages(t *testing.T, rec *httptest.ResponseRecorder, want []string) {
+	t.Helper()
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("ステータスコード: got %d, want %d (%s)", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	var got []string
+	decode(t, rec, &got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("エラーメッセージ: got %v, want %v", got, want)
+	}
+}
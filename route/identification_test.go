@@ -0,0 +1,183 @@
+package route
+
+import (
+	"encoding/base64"
+	"errors"
+	"face-recognition/model"
+	"net/http"
+	"testing"
+)
+
+type identificationResponse struct {
+	Identified       bool    `json:"identified"`
+	Decision         string  `json:"decision"`
+	UserId           float64 `json:"userId"`
+	Username         string  `json:"username"`
+	Similarity       float64 `json:"similarity"`
+	FaceEnrollmentId float64 `json:"faceEnrollmentId"`
+}
+
+// 顔識別APIを呼び出す
+func (ts *testServer) identify(token string, photo string) identificationResponse {
+	ts.t.Helper()
+	rec := ts.request(http.MethodPost, "/api/v1/face-identification", token, map[string]string{"photo": photo})
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("顔識別: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	var res identificationResponse
+	decode(ts.t, rec, &res)
+	return res
+}
+
+func TestFaceIdentification(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("test2@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	kiosk := ts.kiosk()
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	enrollment := model.FaceEnrollment{}
+	ts.server.DB.Where("mst_user_id = ?", user.Id).Find(&enrollment)
+
+	res := ts.identify(kiosk, fixturePhoto(t, "match.png"))
+	if !res.Identified || res.UserId != user.Id || res.FaceEnrollmentId != enrollment.Id || res.Similarity < 90 {
+		t.Fatalf("識別結果: got %+v", res)
+	}
+	result := model.FaceRecognitionResult{}
+	ts.server.DB.Find(&result)
+	if result.MstUserId != user.Id || result.Method != model.RecognitionMethodIdentification || result.FaceEnrollmentId == nil || *result.FaceEnrollmentId != enrollment.Id {
+		t.Errorf("顔認証結果: got %+v", result)
+	}
+
+	// 登録されていない顔は特定できず、結果も記録しない
+	if res := ts.identify(kiosk, base64.StdEncoding.EncodeToString([]byte("unknown"))); res.Identified {
+		t.Errorf("未登録の顔を特定した: %+v", res)
+	}
+	var count int
+	ts.server.DB.Model(&model.FaceRecognitionResult{}).Count(&count)
+	if count != 1 {
+		t.Errorf("顔認証結果の件数: got %d, want 1", count)
+	}
+
+	// QRトークンによる顔認証の結果は方式を区別して記録する
+	ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+		"qrToken": ts.qrToken(ts.login("test1@test.co.jp")),
+		"photo":   fixturePhoto(t, "match.png"),
+	})
+	latest := model.FaceRecognitionResult{}
+	ts.server.DB.Order("id DESC").First(&latest)
+	if latest.Method != model.RecognitionMethodQrToken {
+		t.Errorf("認証方式: got %s, want %s", latest.Method, model.RecognitionMethodQrToken)
+	}
+}
+
+func TestFaceIdentificationExcludesInactive(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.setRole("admin@test.co.jp", "admin")
+	admin := ts.login("admin@test.co.jp")
+	kiosk := ts.kiosk()
+	path := ts.userPath("test1@test.co.jp")
+
+	if rec := ts.request(http.MethodPost, "/api/v1/face-identification", ts.login("test1@test.co.jp"), map[string]string{"photo": fixturePhoto(t, "match.png")}); rec.Code != http.StatusForbidden {
+		t.Errorf("一般ユーザによる顔識別: ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	rec := ts.request(http.MethodPost, "/api/v1/face-identification", kiosk, map[string]string{"photo": "@@@"})
+	assertMessages(t, rec, []string{"写真のフォーマットが不正です"})
+
+	// 利用停止中のユーザは特定しない
+	ts.request(http.MethodPatch, path, admin, map[string]string{"status": "suspended"})
+	if res := ts.identify(kiosk, fixturePhoto(t, "match.png")); res.Identified {
+		t.Errorf("利用停止中のユーザを特定した: %+v", res)
+	}
+	ts.request(http.MethodPatch, path, admin, map[string]string{"status": "active"})
+	if res := ts.identify(kiosk, fixturePhoto(t, "match.png")); !res.Identified {
+		t.Errorf("利用再開後に特定できない: %+v", res)
+	}
+
+	// 利用終了にした顔写真は索引から削除され、特定しない
+	if rec := ts.request(http.MethodPut, path+"/photo", admin, map[string]string{"photo": base64.StdEncoding.EncodeToString([]byte("new"))}); rec.Code != http.StatusOK {
+		t.Fatalf("再登録: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	if res := ts.identify(kiosk, fixturePhoto(t, "match.png")); res.Identified {
+		t.Errorf("利用終了にした顔写真で特定した: %+v", res)
+	}
+}
+
+func TestIndexPendingEnrollments(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	kiosk := ts.kiosk()
+
+	// 索引に未登録の顔写真（1:N検索の導入前の登録）は特定できない
+	ts.server.DB.Model(&model.FaceEnrollment{}).Update("face_id", "")
+	if res := ts.identify(kiosk, fixturePhoto(t, "match.png")); res.Identified {
+		t.Fatalf("索引に未登録の顔写真で特定した: %+v", res)
+	}
+	indexed, err := ts.server.IndexPendingEnrollments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 顔認証端末のユーザの写真も登録される
+	if indexed != 2 {
+		t.Errorf("登録件数: got %d, want 2", indexed)
+	}
+	if res := ts.identify(kiosk, fixturePhoto(t, "match.png")); !res.Identified {
+		t.Errorf("索引に登録後に特定できない: %+v", res)
+	}
+	if indexed, _ := ts.server.IndexPendingEnrollments(); indexed != 0 {
+		t.Errorf("2回目の登録件数: got %d, want 0", indexed)
+	}
+}
+
+func TestReplacePhotoIndexFailure(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	token := ts.login("test1@test.co.jp")
+	kiosk := ts.kiosk()
+	old := model.FaceEnrollment{}
+	ts.server.DB.Where("version = 1").Order("id").First(&old)
+	if old.FaceId == "" || !ts.matcher.Indexed(old.FaceId) {
+		t.Fatalf("登録時の写真が索引に登録されていない: %+v", old)
+	}
+
+	// 索引を更新できなくても、DBの置き換えはコミットされる
+	ts.matcher.SetIndexError(errors.New("index unavailable"))
+	rec := ts.request(http.MethodPut, "/api/v1/users/me/photo", token, map[string]string{"photo": fixturePhoto(t, "match.png")})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	var enrollment model.FaceEnrollment
+	ts.server.DB.Where("id = ?", old.Id).Find(&old)
+	ts.server.DB.Where("mst_user_id = ? AND active = ?", old.MstUserId, true).Find(&enrollment)
+	if old.Active || enrollment.Version != 2 || enrollment.FaceId != "" {
+		t.Fatalf("置き換え後の登録履歴: got %+v / %+v", old, enrollment)
+	}
+	// 削除できなかった顔は顔IDを残すが、利用終了にした写真では特定しない
+	if old.FaceId == "" || !ts.matcher.Indexed(old.FaceId) {
+		t.Errorf("削除できなかった顔: got %+v", old)
+	}
+	ts.matcher.SetIndexError(nil)
+	if res := ts.identify(kiosk, fixturePhoto(t, "mismatch.png")); res.Identified {
+		t.Errorf("利用終了にした顔写真で特定した: %+v", res)
+	}
+	if res := ts.identify(kiosk, fixturePhoto(t, "match.png")); res.Identified {
+		t.Errorf("索引に未登録の顔写真で特定した: %+v", res)
+	}
+
+	// index-facesサブコマンドで索引を登録履歴に揃える
+	if indexed, err := ts.server.IndexPendingEnrollments(); err != nil || indexed != 1 {
+		t.Fatalf("登録件数: got %d %v, want 1", indexed, err)
+	}
+	if ts.matcher.Indexed(old.FaceId) {
+		t.Error("利用終了にした顔が索引に残っている")
+	}
+	ts.server.DB.Where("id = ?", old.Id).Find(&old)
+	if old.FaceId != "" {
+		t.Errorf("索引から削除した顔の顔ID: got %s", old.FaceId)
+	}
+	if res := ts.identify(kiosk, fixturePhoto(t, "match.png")); !res.Identified || res.FaceEnrollmentId != enrollment.Id {
+		t.Errorf("索引に登録後に特定できない: %+v", res)
+	}
+}
@@ -0,0 +1,68 @@
+package route
+
+import (
+	"encoding/base64"
+	"face-recognition/model"
+	"face-recognition/storage"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestLocalImageURL(t *testing.T) {
+	ts := newTestServer(t)
+	dir, err := ioutil.TempDir("", "face-recognition-images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	store, err := storage.NewLocalStore(dir, "http://example.com/images", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.server.Store = store
+	ts.echo = Init(ts.server, DefaultBodyLogConfig)
+	photo := fixturePhoto(t, "match.png")
+	ts.register("test1@test.co.jp", photo)
+	token := ts.login("test1@test.co.jp")
+
+	// 保存したURLは署名がないため参照できない
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	stored, err := url.Parse(user.Photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := ts.request(http.MethodGet, stored.RequestURI(), "", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("署名のないURL: ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	// レスポンスの写真は署名付きURLで参照できる
+	var me model.MstUser
+	decode(t, ts.request(http.MethodGet, "/api/v1/users/me", token, nil), &me)
+	var enrollments []model.FaceEnrollment
+	decode(t, ts.request(http.MethodGet, "/api/v1/users/me/enrollments", token, nil), &enrollments)
+	if len(enrollments) != 1 {
+		t.Fatalf("登録履歴: got %+v", enrollments)
+	}
+	want, err := base64.StdEncoding.DecodeString(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, photoURL := range []string{me.Photo, enrollments[0].Photo} {
+		signed, err := url.Parse(photoURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signed.Host != "example.com" || signed.Query().Get("signature") == "" {
+			t.Errorf("署名付きURLではない: %s", photoURL)
+			continue
+		}
+		rec := ts.request(http.MethodGet, signed.RequestURI(), "", nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != string(want) {
+			t.Errorf("%s: ステータスコード: got %d", photoURL, rec.Code)
+		}
+	}
+}
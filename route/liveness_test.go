@@ -0,0 +1,306 @@
+package route
+
+import (
+	"encoding/base64"
+	"face-recognition/matcher"
+	"face-recognition/model"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type challengeResponse struct {
+	ChallengeId string    `json:"challengeId"`
+	Steps       []string  `json:"steps"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// ライブネスチャレンジ発行
+func (ts *testServer) challenge(kiosk string) challengeResponse {
+	ts.t.Helper()
+	rec := ts.request(http.MethodPost, "/api/v1/face-recognition/challenges", kiosk, nil)
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("ライブネスチャレンジ発行: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	var res challengeResponse
+	decode(ts.t, rec, &res)
+	return res
+}
+
+// 撮影した写真と同じ人物の連続フレームを作る（フレームごとに指定した動作の顔にする）
+// 動作が空のフレームは正面を向いた顔
+func (ts *testServer) frames(photo string, steps ...string) []string {
+	ts.t.Helper()
+	data, err := base64.StdEncoding.DecodeString(photo)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	var frames []string
+	for i, step := range steps {
+		frame := base64.StdEncoding.EncodeToString(append(append([]byte(nil), data...), []byte("frame"+strconv.Itoa(i))...))
+		ts.matcher.SetSimilarity(imageHash(ts.t, photo), imageHash(ts.t, frame), 99)
+		ts.matcher.SetFaceDetail(imageHash(ts.t, frame), stepFace(step))
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// 動作をしている顔
+func stepFace(step string) matcher.FaceDetail {
+	face := goodFace()
+	switch step {
+	case model.LivenessStepTurnLeft:
+		face.Pose.Yaw = -35
+	case model.LivenessStepTurnRight:
+		face.Pose.Yaw = 35
+	case model.LivenessStepLookUp:
+		face.Pose.Pitch = 25
+	case model.LivenessStepLookDown:
+		face.Pose.Pitch = -25
+	case model.LivenessStepBlink:
+		face.EyesOpen = false
+	}
+	return face
+}
+
+func (ts *testServer) recognizeWithChallenge(kiosk string, qrToken string, photo string, challengeId string, frames []string) (int, map[string]interface{}) {
+	ts.t.Helper()
+	rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]interface{}{
+		"qrToken":     qrToken,
+		"photo":       photo,
+		"challengeId": challengeId,
+		"frames":      frames,
+	})
+	var res map[string]interface{}
+	decode(ts.t, rec, &res)
+	return rec.Code, res
+}
+
+func TestLivenessChallenge(t *testing.T) {
+	ts := newTestServer(t)
+	kiosk := ts.kiosk()
+	challenge := ts.challenge(kiosk)
+	if challenge.ChallengeId == "" || !challenge.ExpiresAt.Equal(ts.now.Add(time.Minute)) {
+		t.Errorf("チャレンジ: got %+v", challenge)
+	}
+	if len(challenge.Steps) != 2 || challenge.Steps[0] == challenge.Steps[1] {
+		t.Errorf("動作: got %v", challenge.Steps)
+	}
+	for _, step := range challenge.Steps {
+		valid := false
+		for _, s := range model.LivenessSteps {
+			valid = valid || s == step
+		}
+		if !valid {
+			t.Errorf("未対応の動作: %s", step)
+		}
+	}
+
+	// 顔認証の権限がなければ発行できない
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	if rec := ts.request(http.MethodPost, "/api/v1/face-recognition/challenges", ts.login("test1@test.co.jp"), nil); rec.Code != http.StatusForbidden {
+		t.Errorf("ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestRecognizeWithLiveness(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+	qrToken := ts.qrToken(token)
+	kiosk := ts.kiosk()
+	photo := fixturePhoto(t, "match.png")
+
+	challenge := ts.challenge(kiosk)
+	frames := ts.frames(photo, "", challenge.Steps[0], "", challenge.Steps[1])
+	code, res := ts.recognizeWithChallenge(kiosk, qrToken, photo, challenge.ChallengeId, frames)
+	if code != http.StatusOK || res["authResult"] != true || res["outcome"] != model.OutcomeMatched {
+		t.Fatalf("顔認証: got %d %v", code, res)
+	}
+	result := model.FaceRecognitionResult{}
+	ts.server.DB.Order("id DESC").First(&result)
+	stored := model.LivenessChallenge{}
+	ts.server.DB.Where("challenge_id = ?", challenge.ChallengeId).Find(&stored)
+	if result.LivenessChallengeId == nil || *result.LivenessChallengeId != stored.Id || stored.UsedAt == nil {
+		t.Errorf("顔認証結果のチャレンジ: got %v, want %v", result.LivenessChallengeId, stored.Id)
+	}
+
+	// 同じチャレンジは再利用できない（QRトークンは使用済みのため取得し直す）
+	code, res = ts.recognizeWithChallenge(kiosk, ts.qrToken(token), photo, challenge.ChallengeId, frames)
+	if code != http.StatusBadRequest {
+		t.Errorf("再利用: got %d %v", code, res)
+	}
+}
+
+func TestRecognizeWithLivenessFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames func(ts *testServer, photo string, steps []string) []string
+	}{
+		{
+			name: "動作なし（写真の提示）",
+			frames: func(ts *testServer, photo string, steps []string) []string {
+				return ts.frames(photo, "", "", "")
+			},
+		},
+		{
+			name: "動作の順番が違う",
+			frames: func(ts *testServer, photo string, steps []string) []string {
+				return ts.frames(photo, steps[1], steps[0])
+			},
+		},
+		{
+			name: "一部の動作のみ",
+			frames: func(ts *testServer, photo string, steps []string) []string {
+				return ts.frames(photo, "", steps[0])
+			},
+		},
+		{
+			name: "別人のフレーム",
+			frames: func(ts *testServer, photo string, steps []string) []string {
+				frames := ts.frames(photo, steps[0], steps[1])
+				// 写真と同じ人物の台本がないフレーム
+				other := fixturePhoto(t, "mismatch.png")
+				ts.matcher.SetFaceDetail(imageHash(t, other), stepFace(steps[1]))
+				return []string{frames[0], other}
+			},
+		},
+		{
+			name: "フレームに顔が複数",
+			frames: func(ts *testServer, photo string, steps []string) []string {
+				frames := ts.frames(photo, steps[0], steps[1])
+				ts.matcher.SetFaces(imageHash(t, frames[1]), 2)
+				return frames
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+			qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+			kiosk := ts.kiosk()
+			photo := fixturePhoto(t, "match.png")
+			challenge := ts.challenge(kiosk)
+
+			code, res := ts.recognizeWithChallenge(kiosk, qrToken, photo, challenge.ChallengeId, tt.frames(ts, photo, challenge.Steps))
+			if code != http.StatusOK || res["authResult"] != false || res["outcome"] != model.OutcomeLivenessFailed {
+				t.Errorf("顔認証: got %d %v", code, res)
+			}
+			result := model.FaceRecognitionResult{}
+			ts.server.DB.Order("id DESC").First(&result)
+			if result.Outcome != model.OutcomeLivenessFailed || result.Decision != "reject" || result.Result != 0 {
+				t.Errorf("顔認証結果: got %+v", result)
+			}
+		})
+	}
+}
+
+func TestRecognizeWithLivenessProbeFailed(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+	kiosk := ts.kiosk()
+	photo := fixturePhoto(t, "match.png")
+	challenge := ts.challenge(kiosk)
+	frames := ts.frames(photo, challenge.Steps[0], challenge.Steps[1])
+
+	// 撮影した写真から顔を確認できなければチャレンジを利用済みにしない
+	ts.matcher.SetFaces(imageHash(t, photo), 0)
+	code, res := ts.recognizeWithChallenge(kiosk, qrToken, photo, challenge.ChallengeId, frames)
+	if code != http.StatusOK || res["outcome"] != model.OutcomeNoFaceDetected {
+		t.Fatalf("顔認証: got %d %v", code, res)
+	}
+	stored := model.LivenessChallenge{}
+	ts.server.DB.Where("challenge_id = ?", challenge.ChallengeId).Find(&stored)
+	if stored.UsedAt != nil {
+		t.Errorf("チャレンジが利用済みになった: %v", stored.UsedAt)
+	}
+	// 同じチャレンジで撮り直せる
+	ts.matcher.SetFaces(imageHash(t, photo), 1)
+	code, res = ts.recognizeWithChallenge(kiosk, qrToken, photo, challenge.ChallengeId, frames)
+	if code != http.StatusOK || res["outcome"] != model.OutcomeMatched {
+		t.Errorf("撮り直し: got %d %v", code, res)
+	}
+}
+
+func TestRecognizeWithInvalidChallenge(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("kiosk2@test.co.jp", fixturePhoto(t, "no_face.png"))
+	ts.setRole("kiosk2@test.co.jp", "kiosk")
+	otherKiosk := ts.login("kiosk2@test.co.jp")
+	qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+	kiosk := ts.kiosk()
+	photo := fixturePhoto(t, "match.png")
+
+	// 別の端末に発行したチャレンジ
+	challenge := ts.challenge(otherKiosk)
+	frames := ts.frames(photo, challenge.Steps[0], challenge.Steps[1])
+	if code, res := ts.recognizeWithChallenge(kiosk, qrToken, photo, challenge.ChallengeId, frames); code != http.StatusBadRequest {
+		t.Errorf("別の端末: got %d %v", code, res)
+	}
+	// 存在しないチャレンジ
+	if code, res := ts.recognizeWithChallenge(kiosk, qrToken, photo, "unknown", frames); code != http.StatusBadRequest {
+		t.Errorf("存在しない: got %d %v", code, res)
+	}
+	// 期限切れ
+	challenge = ts.challenge(kiosk)
+	ts.now = ts.now.Add(2 * time.Minute)
+	frames = ts.frames(photo, challenge.Steps[0], challenge.Steps[1])
+	if code, res := ts.recognizeWithChallenge(kiosk, qrToken, photo, challenge.ChallengeId, frames); code != http.StatusBadRequest {
+		t.Errorf("期限切れ: got %d %v", code, res)
+	}
+	var count int
+	ts.server.DB.Model(&model.FaceRecognitionResult{}).Count(&count)
+	if count != 0 {
+		t.Errorf("顔認証結果の件数: got %d, want 0", count)
+	}
+}
+
+func TestRecognizeLivenessParams(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+	kiosk := ts.kiosk()
+	photo := fixturePhoto(t, "match.png")
+
+	tests := []struct {
+		name string
+		body map[string]interface{}
+		want []string
+	}{
+		{
+			name: "チャレンジIDなし",
+			body: map[string]interface{}{"qrToken": qrToken, "photo": photo, "frames": []string{photo}},
+			want: []string{"チャレンジIDは必須項目です"},
+		},
+		{
+			name: "フレームなし",
+			body: map[string]interface{}{"qrToken": qrToken, "photo": photo, "challengeId": "xxx"},
+			want: []string{"フレームは必須項目です"},
+		},
+		{
+			name: "フレームのフォーマット",
+			body: map[string]interface{}{"qrToken": qrToken, "photo": photo, "challengeId": "xxx", "frames": []string{photo, "あ"}},
+			want: []string{"フレームのフォーマットが不正です"},
+		},
+		{
+			name: "フレームが多すぎる",
+			body: map[string]interface{}{"qrToken": qrToken, "photo": photo, "challengeId": "xxx", "frames": make([]string, 11)},
+			want: []string{"フレームは10枚以内で指定してください"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, tt.body)
+			assertMessages(t, rec, tt.want)
+		})
+	}
+
+	// 必須にした場合はチャレンジなしの顔認証を受け付けない
+	ts.server.LivenessRequired = true
+	rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{"qrToken": qrToken, "photo": photo})
+	assertMessages(t, rec, []string{"ライブネスチャレンジは必須です"})
+}
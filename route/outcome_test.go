@@ -0,0 +1,143 @@
+package route
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"face-recognition/matcher"
+	"face-recognition/model"
+	"net/http"
+	"testing"
+)
+
+// 画像（base64）の台本用の識別子
+func imageHash(t *testing.T, photo string) string {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestRecognitionOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(ts *testServer, hash string)
+		photo   string
+		code    int
+		outcome string
+	}{
+		{name: "本人", photo: "match.png", code: http.StatusOK, outcome: model.OutcomeMatched},
+		{name: "別人", photo: "mismatch.png", code: http.StatusOK, outcome: model.OutcomeNotMatched},
+		{
+			name:    "顔なし",
+			setup:   func(ts *testServer, hash string) { ts.matcher.SetFaces(hash, 0) },
+			code:    http.StatusOK,
+			outcome: model.OutcomeNoFaceDetected,
+		},
+		{
+			name:    "複数の顔",
+			setup:   func(ts *testServer, hash string) { ts.matcher.SetFaces(hash, 2) },
+			code:    http.StatusOK,
+			outcome: model.OutcomeMultipleFaces,
+		},
+		{
+			name: "顔が小さい",
+			setup: func(ts *testServer, hash string) {
+				ts.matcher.SetFaceDetail(hash, matcher.FaceDetail{Confidence: 99, BoundingBox: matcher.BoundingBox{Width: 0.02, Height: 0.03}})
+			},
+			code:    http.StatusOK,
+			outcome: model.OutcomeLowQuality,
+		},
+		{
+			name: "不鮮明",
+			setup: func(ts *testServer, hash string) {
+				ts.matcher.SetFaceDetail(hash, matcher.FaceDetail{Confidence: 60, BoundingBox: matcher.BoundingBox{Width: 0.5, Height: 0.5}})
+			},
+			code:    http.StatusOK,
+			outcome: model.OutcomeLowQuality,
+		},
+		{
+			name:    "顔照合エンジンのエラー",
+			setup:   func(ts *testServer, hash string) { ts.matcher.SetError(errors.New("unavailable")) },
+			code:    http.StatusInternalServerError,
+			outcome: model.OutcomeBackendError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+			qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+			kiosk := ts.kiosk()
+			// 台本で顔の状態を変える場合は本人の画像を使う
+			name := tt.photo
+			if name == "" {
+				name = "match.png"
+			}
+			probe := fixturePhoto(t, name)
+			if tt.setup != nil {
+				tt.setup(ts, imageHash(t, probe))
+			}
+
+			rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+				"qrToken": qrToken,
+				"photo":   probe,
+			})
+			if rec.Code != tt.code {
+				t.Fatalf("ステータスコード: got %d, want %d (%s)", rec.Code, tt.code, rec.Body.String())
+			}
+			var res struct {
+				AuthResult bool   `json:"authResult"`
+				Outcome    string `json:"outcome"`
+			}
+			decode(t, rec, &res)
+			if res.Outcome != tt.outcome || res.AuthResult != (tt.outcome == model.OutcomeMatched) {
+				t.Errorf("レスポンス: got %+v, want %s", res, tt.outcome)
+			}
+			// 比較できなかった場合も理由を記録する
+			result := model.FaceRecognitionResult{}
+			ts.server.DB.Find(&result)
+			if result.Outcome != tt.outcome {
+				t.Errorf("記録した結果の種類: got %s, want %s", result.Outcome, tt.outcome)
+			}
+			if tt.outcome != model.OutcomeMatched && tt.outcome != model.OutcomeNotMatched && (result.Result != 0 || result.Decision != "reject") {
+				t.Errorf("比較できなかった結果: got %+v", result)
+			}
+		})
+	}
+}
+
+func TestIdentificationOutcome(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	kiosk := ts.kiosk()
+	probe := fixturePhoto(t, "match.png")
+	ts.matcher.SetFaces(imageHash(t, probe), 2)
+
+	rec := ts.request(http.MethodPost, "/api/v1/face-identification", kiosk, map[string]string{"photo": probe})
+	var res struct {
+		Identified bool   `json:"identified"`
+		Outcome    string `json:"outcome"`
+	}
+	decode(t, rec, &res)
+	if res.Identified || res.Outcome != model.OutcomeMultipleFaces {
+		t.Errorf("識別結果: got %+v", res)
+	}
+	// 利用者を特定できないため記録しない
+	var count int
+	ts.server.DB.Model(&model.FaceRecognitionResult{}).Count(&count)
+	if count != 0 {
+		t.Errorf("顔認証結果の件数: got %d, want 0", count)
+	}
+
+	ts.matcher.SetError(errors.New("unavailable"))
+	rec = ts.request(http.MethodPost, "/api/v1/face-identification", kiosk, map[string]string{"photo": fixturePhoto(t, "mismatch.png")})
+	decode(t, rec, &res)
+	if rec.Code != http.StatusInternalServerError || res.Outcome != model.OutcomeBackendError {
+		t.Errorf("顔照合エンジンのエラー: got %d %+v", rec.Code, res)
+	}
+}
@@ -0,0 +1,144 @@
+package route
+
+import (
+	"bytes"
+	"encoding/xml"
+	"face-recognition/auth"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"image/png"
+	"net/http"
+	"testing"
+)
+
+func TestQrTokenPNG(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+
+	tests := []struct {
+		name  string
+		query string
+		size  int
+		level qrcode.RecoveryLevel
+	}{
+		{name: "デフォルト", size: 256, level: qrcode.Medium},
+		{name: "大きさと誤り訂正レベルの指定", query: "?size=512&level=highest", size: 512, level: qrcode.Highest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.request(http.MethodGet, "/api/v1/qr-token.png"+tt.query, token, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+			}
+			if rec.Header().Get("Content-Type") != "image/png" || rec.Header().Get("Cache-Control") != "no-store" {
+				t.Errorf("ヘッダ: got %v", rec.Header())
+			}
+			img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dx() != tt.size || img.Bounds().Dy() != tt.size {
+				t.Errorf("大きさ: got %v, want %d", img.Bounds(), tt.size)
+			}
+			// 現在のQRトークンをQRコードにした画像
+			want, err := qrcode.Encode(ts.qrToken(token), tt.level, tt.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(rec.Body.Bytes(), want) {
+				t.Error("現在のQRトークンのQRコードではない")
+			}
+		})
+	}
+}
+
+func TestQrTokenSVG(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+
+	rec := ts.request(http.MethodGet, "/api/v1/qr-token.svg?size=300&level=low", token, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "image/svg+xml" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("ヘッダ: got %v", rec.Header())
+	}
+	var svg struct {
+		Width   string `xml:"width,attr"`
+		Height  string `xml:"height,attr"`
+		ViewBox string `xml:"viewBox,attr"`
+		Path    struct {
+			D string `xml:"d,attr"`
+		} `xml:"path"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &svg); err != nil {
+		t.Fatalf("SVGのデコード失敗: %v", err)
+	}
+	code, err := qrcode.New(ts.qrToken(token), qrcode.Low)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := len(code.Bitmap())
+	if svg.Width != "300" || svg.Height != "300" || svg.ViewBox != fmt.Sprintf("0 0 %d %d", n, n) {
+		t.Errorf("大きさ: got %s x %s (%s), want 300 x 300 (0 0 %d %d)", svg.Width, svg.Height, svg.ViewBox, n, n)
+	}
+	// 黒いモジュールの数が一致する
+	dark := 0
+	for _, row := range code.Bitmap() {
+		for _, v := range row {
+			if v {
+				dark++
+			}
+		}
+	}
+	painted := 0
+	var x, y, w, back int
+	for _, cmd := range bytes.Split([]byte(svg.Path.D), []byte("z")) {
+		if len(cmd) == 0 {
+			continue
+		}
+		if _, err := fmt.Sscanf(string(cmd), "M%d %dh%dv1h-%d", &x, &y, &w, &back); err != nil || w != back {
+			t.Fatalf("パス: %s (%v)", cmd, err)
+		}
+		painted += w
+	}
+	if painted != dark {
+		t.Errorf("黒いモジュールの数: got %d, want %d", painted, dark)
+	}
+}
+
+func TestQrTokenImageParams(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "小さすぎる", query: "?size=10", want: []string{"サイズは64〜2048で指定してください"}},
+		{name: "数値でない", query: "?size=big", want: []string{"サイズは64〜2048で指定してください"}},
+		{
+			name:  "未対応の誤り訂正レベル",
+			query: "?size=4096&level=max",
+			want:  []string{"サイズは64〜2048で指定してください", "誤り訂正レベルはlow・medium・high・highestのいずれかを指定してください"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range []string{"/api/v1/qr-token.png", "/api/v1/qr-token.svg"} {
+				assertMessages(t, ts.request(http.MethodGet, path+tt.query, token, nil), tt.want)
+			}
+		})
+	}
+
+	// QRトークンを発行できないロールは取得できない
+	ts.register("kiosk@test.co.jp", fixturePhoto(t, "no_face.png"))
+	ts.setRole("kiosk@test.co.jp", auth.RoleKiosk)
+	if rec := ts.request(http.MethodGet, "/api/v1/qr-token.png", ts.login("kiosk@test.co.jp"), nil); rec.Code != http.StatusForbidden {
+		t.Errorf("ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,117 @@
+package route
+
+import (
+	"face-recognition/model"
+	"github.com/dgrijalva/jwt-go"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// QRトークンで顔認証し、ステータスコードとメッセージを返す
+func (ts *testServer) recognizeQr(kiosk string, qrToken string) (int, string) {
+	ts.t.Helper()
+	rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+		"qrToken": qrToken,
+		"photo":   fixturePhoto(ts.t, "match.png"),
+	})
+	var res struct {
+		Message string `json:"message"`
+	}
+	decode(ts.t, rec, &res)
+	return rec.Code, res.Message
+}
+
+func TestQrTokenRotation(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+	kiosk := ts.kiosk()
+
+	issuedAt := ts.now
+	first := ts.qrToken(token)
+	claims := jwt.MapClaims{}
+	if _, err := ts.server.QrKeys.Parse(first, claims); err != nil {
+		t.Fatal(err)
+	}
+	if exp, _ := claims["exp"].(float64); int64(exp) != issuedAt.Add(5*time.Minute).Unix() {
+		t.Errorf("exp: got %v, want %v", claims["exp"], issuedAt.Add(5*time.Minute).Unix())
+	}
+	stored := model.QrToken{}
+	ts.server.DB.Where("qr_token = ?", first).Find(&stored)
+	if !stored.IssuedAt.Equal(issuedAt) || !stored.ExpiresAt.Equal(issuedAt.Add(5*time.Minute)) {
+		t.Errorf("発行日時・有効期限: got %v/%v", stored.IssuedAt, stored.ExpiresAt)
+	}
+
+	// ローテーションの間隔内は同じトークン
+	ts.now = ts.now.Add(59 * time.Second)
+	if second := ts.qrToken(token); second != first {
+		t.Errorf("ローテーションの間隔内に別のQRトークンが返却された")
+	}
+	// 間隔を過ぎると新しいトークンに置き換わり、以前のトークンは顔認証に使えない
+	ts.now = ts.now.Add(2 * time.Second)
+	rotated := ts.qrToken(token)
+	if rotated == first {
+		t.Fatal("QRトークンが置き換わっていない")
+	}
+	if code, message := ts.recognizeQr(kiosk, first); code != http.StatusUnauthorized || message != "QRトークンは新しいトークンに置き換えられています" {
+		t.Errorf("置き換え済みのトークン: got %d %s", code, message)
+	}
+	if code, message := ts.recognizeQr(kiosk, rotated); code != http.StatusOK {
+		t.Errorf("新しいトークン: got %d %s", code, message)
+	}
+	var count int
+	ts.server.DB.Model(&model.QrToken{}).Count(&count)
+	if count != 1 {
+		t.Errorf("QRトークンの件数: got %d, want 1", count)
+	}
+}
+
+func TestQrTokenExpired(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+	kiosk := ts.kiosk()
+
+	qrToken := ts.qrToken(token)
+	ts.now = ts.now.Add(5 * time.Minute)
+	if code, message := ts.recognizeQr(kiosk, qrToken); code != http.StatusUnauthorized || message != "QRトークンの有効期限が切れています" {
+		t.Errorf("期限切れのトークン: got %d %s", code, message)
+	}
+	// 期限切れのトークンは取得時に置き換える
+	if renewed := ts.qrToken(token); renewed == qrToken {
+		t.Error("期限切れのQRトークンが返却された")
+	}
+
+	// 署名の有効期限（exp）が切れたトークン
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	expired, err := ts.server.QrKeys.Sign(jwt.MapClaims{"userId": user.Id, "exp": time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.server.DB.Model(&model.QrToken{}).Where("mst_user_id = ?", user.Id).Update("qr_token", expired)
+	if code, message := ts.recognizeQr(kiosk, expired); code != http.StatusUnauthorized || message != "QRトークンの有効期限が切れています" {
+		t.Errorf("expの切れたトークン: got %d %s", code, message)
+	}
+	var count int
+	ts.server.DB.Model(&model.FaceRecognitionResult{}).Count(&count)
+	if count != 0 {
+		t.Errorf("顔認証結果の件数: got %d, want 0", count)
+	}
+}
+
+func TestQrTokenInvalidUserId(t *testing.T) {
+	ts := newTestServer(t)
+	kiosk := ts.kiosk()
+	// 正しく署名されていてもuserIdが数値でなければユーザを特定できない
+	for _, claims := range []jwt.MapClaims{{"userId": "1"}, {"sub": "1"}} {
+		qrToken, err := ts.server.QrKeys.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code, message := ts.recognizeQr(kiosk, qrToken); code != http.StatusBadRequest || message != "QRトークンからユーザーを特定できませんでした" {
+			t.Errorf("%v: got %d %s", claims, code, message)
+		}
+	}
+}
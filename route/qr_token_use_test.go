@@ -0,0 +1,101 @@
+package route
+
+import (
+	"face-recognition/model"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestQrTokenOneTimeUse(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+	kiosk := ts.kiosk()
+	qrToken := ts.qrToken(token)
+
+	// 本人と判定されなかった顔認証では使用済みにならない
+	rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+		"qrToken": qrToken,
+		"photo":   fixturePhoto(t, "mismatch.png"),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("別人: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	if code, message := ts.recognizeQr(kiosk, qrToken); code != http.StatusOK {
+		t.Fatalf("本人: got %d %s", code, message)
+	}
+	// 成功した後は同じトークンを使えない
+	if code, message := ts.recognizeQr(kiosk, qrToken); code != http.StatusUnauthorized || message != "QRトークンは使用済みです" {
+		t.Errorf("使用済みのトークン: got %d %s", code, message)
+	}
+	stored := model.QrToken{}
+	ts.server.DB.Where("qr_token = ?", qrToken).Find(&stored)
+	results := []model.FaceRecognitionResult{}
+	ts.server.DB.Order("id").Find(&results)
+	if stored.Jti == "" || stored.UseCount != 1 || len(results) != 2 || results[0].QrTokenJti != stored.Jti || results[1].QrTokenJti != stored.Jti {
+		t.Errorf("利用回数: got %d, 顔認証結果 %+v", stored.UseCount, results)
+	}
+
+	// 使い切ったトークンは取得時に置き換える
+	renewed := ts.qrToken(token)
+	if renewed == qrToken {
+		t.Fatal("使用済みのQRトークンが返却された")
+	}
+	if code, message := ts.recognizeQr(kiosk, renewed); code != http.StatusOK {
+		t.Errorf("新しいトークン: got %d %s", code, message)
+	}
+}
+
+func TestQrTokenMultiUse(t *testing.T) {
+	ts := newTestServer(t)
+	ts.server.QrTokenMaxUses = 2
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	kiosk := ts.kiosk()
+	qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusUnauthorized} {
+		if code, message := ts.recognizeQr(kiosk, qrToken); code != want {
+			t.Errorf("%d回目: got %d %s, want %d", i+1, code, message, want)
+		}
+	}
+}
+
+func TestQrTokenConcurrentUse(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	kiosk := ts.kiosk()
+	qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+	photo := fixturePhoto(t, "match.png")
+
+	// 同じトークンを同時に提示しても、成功するのは1回だけ
+	const requests = 5
+	codes := make([]int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+				"qrToken": qrToken,
+				"photo":   photo,
+			}).Code
+		}(i)
+	}
+	wg.Wait()
+	succeeded := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusUnauthorized:
+		default:
+			t.Errorf("ステータスコード: got %d", code)
+		}
+	}
+	var count int
+	ts.server.DB.Model(&model.FaceRecognitionResult{}).Count(&count)
+	if succeeded != 1 || count != 1 {
+		t.Errorf("成功した顔認証: got %d（記録 %d件）, want 1 (%v)", succeeded, count, codes)
+	}
+}
@@ -0,0 +1,136 @@
+package route
+
+import (
+	"errors"
+	"face-recognition/matcher"
+	"face-recognition/model"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// 品質に問題のない顔（台本で一部の項目だけ変えて使う）
+func goodFace() matcher.FaceDetail {
+	return matcher.FaceDetail{
+		Confidence:         99.9,
+		BoundingBox:        matcher.BoundingBox{Left: 0.25, Top: 0.25, Width: 0.5, Height: 0.5},
+		Sharpness:          90,
+		EyesOpen:           true,
+		EyesOpenConfidence: 99,
+	}
+}
+
+func TestRegisterPhotoQuality(t *testing.T) {
+	tests := []struct {
+		name  string
+		faces int
+		face  func(d *matcher.FaceDetail)
+		want  []string
+	}{
+		{name: "顔なし", faces: 0, want: []string{model.QualityNoFaceDetected}},
+		{name: "複数の顔", faces: 2, want: []string{model.QualityMultipleFaces}},
+		{name: "顔が小さい", faces: 1, face: func(d *matcher.FaceDetail) { d.BoundingBox.Width = 0.08 }, want: []string{model.QualityFaceTooSmall}},
+		{name: "不鮮明", faces: 1, face: func(d *matcher.FaceDetail) { d.Sharpness = 10 }, want: []string{model.QualityTooBlurry}},
+		{name: "目を閉じている", faces: 1, face: func(d *matcher.FaceDetail) { d.EyesOpen = false }, want: []string{model.QualityEyesClosed}},
+		{name: "目を閉じているか不明", faces: 1, face: func(d *matcher.FaceDetail) { d.EyesOpen, d.EyesOpenConfidence = false, 55 }},
+		{name: "横向き", faces: 1, face: func(d *matcher.FaceDetail) { d.Pose.Yaw = -45 }, want: []string{model.QualityExtremePose}},
+		{
+			name:  "複数の理由",
+			faces: 1,
+			face: func(d *matcher.FaceDetail) {
+				d.BoundingBox.Height = 0.05
+				d.Sharpness = 5
+				d.Pose.Pitch = 40
+			},
+			want: []string{model.QualityFaceTooSmall, model.QualityTooBlurry, model.QualityExtremePose},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			photo := fixturePhoto(t, "match.png")
+			hash := imageHash(t, photo)
+			ts.matcher.SetFaces(hash, tt.faces)
+			if tt.face != nil {
+				detail := goodFace()
+				tt.face(&detail)
+				ts.matcher.SetFaceDetail(hash, detail)
+			}
+
+			rec := ts.request(http.MethodPost, "/api/v1/users/register", "", map[string]string{
+				"email":    "test1@test.co.jp",
+				"username": "テスト太郎",
+				"password": "Password123",
+				"photo":    photo,
+			})
+			var count int
+			ts.server.DB.Model(&model.MstUser{}).Count(&count)
+			if tt.want == nil {
+				if rec.Code != http.StatusOK || count != 1 {
+					t.Errorf("登録できなかった: got %d (%s)", rec.Code, rec.Body.String())
+				}
+				return
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("ステータスコード: got %d, want %d (%s)", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+			var res struct {
+				Reasons []model.QualityReason `json:"reasons"`
+			}
+			decode(t, rec, &res)
+			var codes []string
+			for _, r := range res.Reasons {
+				if r.Message == "" {
+					t.Errorf("理由のメッセージがない: %+v", r)
+				}
+				codes = append(codes, r.Code)
+			}
+			if !reflect.DeepEqual(codes, tt.want) {
+				t.Errorf("理由: got %v, want %v", codes, tt.want)
+			}
+			// 登録できない写真はユーザも登録履歴も作らない
+			var enrollments int
+			ts.server.DB.Model(&model.FaceEnrollment{}).Count(&enrollments)
+			if count != 0 || enrollments != 0 {
+				t.Errorf("件数: got ユーザ %d, 登録履歴 %d, want 0", count, enrollments)
+			}
+		})
+	}
+}
+
+func TestReplacePhotoQuality(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+	photo := fixturePhoto(t, "mismatch.png")
+	ts.matcher.SetFaces(imageHash(t, photo), 2)
+
+	for _, path := range []string{"/api/v1/users/me/photo", "/api/v1/users/me/enrollments"} {
+		method := http.MethodPut
+		if path == "/api/v1/users/me/enrollments" {
+			method = http.MethodPost
+		}
+		rec := ts.request(method, path, token, map[string]string{"photo": photo})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: ステータスコード: got %d, want %d", path, rec.Code, http.StatusBadRequest)
+		}
+	}
+	enrollments := ts.enrollments("/api/v1/users/me/enrollments", token)
+	if len(enrollments) != 1 || !enrollments[0].Active {
+		t.Errorf("登録履歴: got %+v", enrollments)
+	}
+}
+
+func TestRegisterPhotoQualityBackendError(t *testing.T) {
+	ts := newTestServer(t)
+	ts.matcher.SetError(errors.New("service unavailable"))
+	rec := ts.request(http.MethodPost, "/api/v1/users/register", "", map[string]string{
+		"email":    "test1@test.co.jp",
+		"username": "テスト太郎",
+		"password": "Password123",
+		"photo":    fixturePhoto(t, "match.png"),
+	})
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("ステータスコード: got %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
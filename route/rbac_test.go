@@ -0,0 +1,108 @@
+package route
+
+import (
+	"face-recognition/auth"
+	"face-recognition/model"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// GET /usersのレスポンスからユーザ一覧を取り出す
+func (ts *testServer) users(token string) []model.MstUser {
+	ts.t.Helper()
+	rec := ts.request(http.MethodGet, "/api/v1/users", token, nil)
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("ユーザ取得失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var res model.UserList
+	decode(ts.t, rec, &res)
+	return res.Items
+}
+
+func TestPermissions(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("member@test.co.jp", fixturePhoto(t, "match.png"))
+	member := ts.login("member@test.co.jp")
+	kiosk := ts.kiosk()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "一般ユーザはQRトークンを発行できる", method: http.MethodGet, path: "/api/v1/qr-token", token: member, want: http.StatusOK},
+		{name: "一般ユーザは顔認証できない", method: http.MethodPost, path: "/api/v1/face-recognition", token: member, want: http.StatusForbidden},
+		{name: "一般ユーザはロールを変更できない", method: http.MethodPut, path: "/api/v1/users/1/role", token: member, want: http.StatusForbidden},
+		{name: "顔認証端末はQRトークンを発行できない", method: http.MethodGet, path: "/api/v1/qr-token", token: kiosk, want: http.StatusForbidden},
+		{name: "顔認証端末はユーザを参照できない", method: http.MethodGet, path: "/api/v1/users", token: kiosk, want: http.StatusForbidden},
+		{name: "顔認証端末はログアウトできる", method: http.MethodPost, path: "/api/v1/users/logout", token: kiosk, want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.request(tt.method, tt.path, tt.token, nil)
+			if rec.Code != tt.want {
+				t.Errorf("ステータスコード: got %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetUserScope(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+
+	// 管理者以外は自身のみ
+	users := ts.users(ts.login("test1@test.co.jp"))
+	if len(users) != 1 || users[0].Email != "test1@test.co.jp" {
+		t.Errorf("一般ユーザ: got %+v", users)
+	}
+	// 管理者は全ユーザ
+	if users := ts.users(ts.login("admin@test.co.jp")); len(users) != 2 {
+		t.Errorf("管理者: got %+v", users)
+	}
+}
+
+func TestPutUserRole(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+	admin := ts.login("admin@test.co.jp")
+	member := ts.login("test1@test.co.jp")
+
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	path := "/api/v1/users/" + strconv.FormatFloat(user.Id, 'f', -1, 64) + "/role"
+
+	if rec := ts.request(http.MethodPut, path, admin, map[string]string{"role": "owner"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("未定義のロール: ステータスコード: got %d", rec.Code)
+	}
+	rec := ts.request(http.MethodPut, path, admin, map[string]string{"role": "operator"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	// ロールの変更は発行済みのトークンにも即時に反映される
+	if rec := ts.request(http.MethodGet, "/api/v1/qr-token", member, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("変更後の権限: ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	// 管理者に変更すると管理者フラグも立つ
+	ts.request(http.MethodPut, path, admin, map[string]string{"role": "admin"})
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	if user.Role != "admin" || !user.IsAdmin {
+		t.Errorf("管理者フラグ: got %s/%v", user.Role, user.IsAdmin)
+	}
+
+	// 自身の管理者ロールは外せない
+	adminUser := model.MstUser{}
+	ts.server.DB.Where("email = ?", "admin@test.co.jp").Find(&adminUser)
+	self := "/api/v1/users/" + strconv.FormatFloat(adminUser.Id, 'f', -1, 64) + "/role"
+	if rec := ts.request(http.MethodPut, self, admin, map[string]string{"role": "member"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("自身のロール変更: ステータスコード: got %d", rec.Code)
+	}
+}
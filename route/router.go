@@ -2,40 +2,69 @@ package route
 
 import (
 	"face-recognition/api"
-	"face-recognition/config"
-	"face-recognition/logger"
-	"fmt"
+	"face-recognition/auth"
+	"face-recognition/storage"
 	"github.com/labstack/echo"
 	echoMw "github.com/labstack/echo/middleware"
-	"go.uber.org/zap"
 )
 
-func bodyDumpHandler(c echo.Context, reqBody, resBody []byte) {
-	logger.Log.Info("Request Body", zap.String("パラメータ", string(reqBody)))
-	fmt.Printf("Request Body: %v\n", string(reqBody))
-}
-
-func Init() *echo.Echo {
+// ルーティング設定（ハンドラが利用する依存関係は生成済みのサーバから受け取る）
+func Init(s *api.Server, bodyLog BodyLogConfig) *echo.Echo {
 	// インスタンス生成
 	e := echo.New()
 	// アプリケーションのどこかで予期せずにpanicを起こしてしまっても、サーバは落とさずにエラーレスポンスを返せるようにリカバリーする
 	e.Use(echoMw.Recover())
 	// アクセスログ出力
 	e.Use(echoMw.Logger())
-	// リクエストボディの値をログ出力
-	e.Use(echoMw.BodyDump(bodyDumpHandler))
+	// リクエストボディの値をログ出力（パスワード・顔写真などはマスクし、大きいボディは切り詰める）
+	if bodyLog.Logger == nil {
+		bodyLog.Logger = s.Logger
+	}
+	e.Use(BodyLog(bodyLog))
+	// ローカルファイルシステムに保存した画像は署名付きURLで公開する
+	if _, ok := s.Store.(*storage.LocalStore); ok {
+		e.GET("/images/:key", s.GetImage)
+	}
 	// ルーティング
 	// バージョン管理用にパスを束ねる
 	v1 := e.Group("/api/v1")
 	{
-		v1.POST("/users/login", api.PostLogin())
-		v1.POST("/users/register", api.PostUser())
-		// 認証ミドルウェア設定
-		v1.Use(echoMw.JWT([]byte(config.Config.Secret)))
-		// ここより下のエンドポイントはJWT認証必須
-		v1.GET("/users", api.GetUser())
-		v1.GET("/qr-token", api.GetQrToken())
-		v1.POST("/face-recognition", api.PostFaceRecognition())
+		v1.POST("/users/login", s.PostLogin)
+		v1.POST("/users/register", s.PostUser)
+		v1.POST("/users/refresh", s.PostRefresh)
+		// 認証ミドルウェア設定（鍵IDに応じてローテーション前の鍵でも検証する）
+		v1.Use(s.RequireLogin)
+		// ここより下のエンドポイントはJWT認証必須（ロールごとの権限もエンドポイント単位で確認する）
+		v1.GET("/users", s.GetUser, s.RequirePermission(auth.PermissionUserRead))
+		v1.GET("/users/me", s.GetMe, s.RequirePermission(auth.PermissionProfile))
+		v1.PATCH("/users/me", s.PatchMe, s.RequirePermission(auth.PermissionProfile))
+		v1.PUT("/users/me/photo", s.PutMyPhoto, s.RequirePermission(auth.PermissionProfile))
+		v1.GET("/users/me/enrollments", s.GetMyEnrollments, s.RequirePermission(auth.PermissionProfile))
+		v1.POST("/users/me/enrollments", s.PostMyEnrollment, s.RequirePermission(auth.PermissionProfile))
+		v1.DELETE("/users/me/enrollments/:enrollmentId", s.DeleteMyEnrollment, s.RequirePermission(auth.PermissionProfile))
+		v1.GET("/users/:id", s.GetUserById, s.RequirePermission(auth.PermissionUserReadAll))
+		v1.PUT("/users/:id/photo", s.PutUserPhoto, s.RequirePermission(auth.PermissionUserManage))
+		v1.GET("/users/:id/enrollments", s.GetUserEnrollments, s.RequirePermission(auth.PermissionUserReadAll))
+		v1.POST("/users/:id/enrollments", s.PostUserEnrollment, s.RequirePermission(auth.PermissionUserManage))
+		v1.DELETE("/users/:id/enrollments/:enrollmentId", s.DeleteUserEnrollment, s.RequirePermission(auth.PermissionUserManage))
+		v1.PATCH("/users/:id", s.PatchUser, s.RequirePermission(auth.PermissionUserManage))
+		v1.DELETE("/users/:id", s.DeleteUser, s.RequirePermission(auth.PermissionUserManage))
+		v1.PUT("/users/:id/role", s.PutUserRole, s.RequirePermission(auth.PermissionUserManage))
+		v1.PUT("/users/:id/location", s.PutUserLocation, s.RequirePermission(auth.PermissionUserManage))
+		v1.POST("/users/logout", s.PostLogout, s.RequirePermission(auth.PermissionSessionManage))
+		v1.GET("/users/sessions", s.GetSessions, s.RequirePermission(auth.PermissionSessionManage))
+		v1.DELETE("/users/sessions/:id", s.DeleteSession, s.RequirePermission(auth.PermissionSessionManage))
+		v1.GET("/qr-token", s.GetQrToken, s.RequirePermission(auth.PermissionQrTokenIssue))
+		v1.GET("/qr-token.png", s.GetQrTokenPNG, s.RequirePermission(auth.PermissionQrTokenIssue))
+		v1.GET("/qr-token.svg", s.GetQrTokenSVG, s.RequirePermission(auth.PermissionQrTokenIssue))
+		v1.POST("/face-recognition/challenges", s.PostLivenessChallenge, s.RequirePermission(auth.PermissionFaceRecognize))
+		v1.POST("/face-recognition", s.PostFaceRecognition, s.RequirePermission(auth.PermissionFaceRecognize))
+		v1.POST("/face-identification", s.PostFaceIdentification, s.RequirePermission(auth.PermissionFaceRecognize))
+		v1.GET("/thresholds", s.GetThresholds, s.RequirePermission(auth.PermissionThresholdManage))
+		v1.PUT("/thresholds/locations/:location", s.PutLocationThreshold, s.RequirePermission(auth.PermissionThresholdManage))
+		v1.DELETE("/thresholds/locations/:location", s.DeleteLocationThreshold, s.RequirePermission(auth.PermissionThresholdManage))
+		v1.PUT("/users/:id/threshold", s.PutUserThreshold, s.RequirePermission(auth.PermissionThresholdManage))
+		v1.DELETE("/users/:id/threshold", s.DeleteUserThreshold, s.RequirePermission(auth.PermissionThresholdManage))
 	}
 	// 生成したechoを返却
 	return e
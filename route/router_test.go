@@ -0,0 +1,302 @@
+package route
+
+import (
+	"face-recognition/auth"
+	"face-recognition/model"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRegister(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	if user.Id == 0 {
+		t.Fatal("ユーザマスタに登録されていない")
+	}
+	if user.Password == "Password123" {
+		t.Error("パスワードがハッシュ化されていない")
+	}
+	if _, err := ts.store.Get(user.S3Key); err != nil {
+		t.Errorf("画像ストレージに写真が保存されていない: %v", err)
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	ts := newTestServer(t)
+	tests := []struct {
+		name string
+		body map[string]string
+		want []string
+	}{
+		{
+			name: "必須項目なし",
+			body: map[string]string{},
+			want: []string{"メールアドレスは必須項目です", "ユーザー名は必須項目です", "パスワードは必須項目です", "写真は必須項目です"},
+		},
+		{
+			name: "フォーマット不正",
+			body: map[string]string{"email": "test", "username": "テスト", "password": "Password123", "photo": "@@@"},
+			want: []string{"メールアドレスのフォーマットが不正です", "写真のフォーマットが不正です"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.request(http.MethodPost, "/api/v1/users/register", "", tt.body)
+			assertMessages(t, rec, tt.want)
+		})
+	}
+}
+
+func TestRegisterDuplicateEmail(t *testing.T) {
+	ts := newTestServer(t)
+	photo := fixturePhoto(t, "match.png")
+	ts.register("test1@test.co.jp", photo)
+	rec := ts.request(http.MethodPost, "/api/v1/users/register", "", map[string]string{
+		"email":    "test1@test.co.jp",
+		"username": "テスト次郎",
+		"password": "Password123",
+		"photo":    photo,
+	})
+	assertMessages(t, rec, []string{"既に存在するメールアドレスです"})
+}
+
+func TestLogin(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+
+	rec := ts.request(http.MethodPost, "/api/v1/users/login", "", map[string]string{
+		"email":    "test1@test.co.jp",
+		"password": "Password123",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	var res struct {
+		Token string `json:"token"`
+		Admin bool   `json:"admin"`
+	}
+	decode(t, rec, &res)
+	if res.Token == "" {
+		t.Error("トークンが返却されていない")
+	}
+	if res.Admin {
+		t.Error("一般ユーザが管理者として返却された")
+	}
+}
+
+func TestLoginFailure(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{name: "パスワード誤り", email: "test1@test.co.jp", password: "wrong"},
+		{name: "ユーザなし", email: "unknown@test.co.jp", password: "Password123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.request(http.MethodPost, "/api/v1/users/login", "", map[string]string{
+				"email":    tt.email,
+				"password": tt.password,
+			})
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("ステータスコード: got %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestLoginValidation(t *testing.T) {
+	ts := newTestServer(t)
+	rec := ts.request(http.MethodPost, "/api/v1/users/login", "", map[string]string{"email": "test"})
+	assertMessages(t, rec, []string{"メールアドレスのフォーマットが不正です", "パスワードは必須項目です"})
+}
+
+func TestAuthenticationRequired(t *testing.T) {
+	ts := newTestServer(t)
+	for _, path := range []string{"/api/v1/users", "/api/v1/qr-token"} {
+		rec := ts.request(http.MethodGet, path, "", nil)
+		if rec.Code == http.StatusOK {
+			t.Errorf("%s: トークンなしでアクセスできた", path)
+		}
+		rec = ts.request(http.MethodGet, path, "invalid", nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: ステータスコード: got %d, want %d", path, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestSessionAndQrKeysAreSeparated(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+	qrToken := ts.qrToken(token)
+
+	// QRトークンではAPIにアクセスできない
+	rec := ts.request(http.MethodGet, "/api/v1/users", qrToken, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("QRトークン: ステータスコード: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	// セッション用のトークンでは顔認証できない
+	rec = ts.request(http.MethodPost, "/api/v1/face-recognition", ts.kiosk(), map[string]string{
+		"qrToken": token,
+		"photo":   fixturePhoto(t, "match.png"),
+	})
+	if rec.Code == http.StatusOK {
+		t.Error("セッション用のトークンで顔認証できた")
+	}
+}
+
+func TestSessionKeyRotation(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	oldToken := ts.login("test1@test.co.jp")
+
+	// 鍵をローテーションし、旧鍵は1時間だけ検証に使う
+	keys, err := auth.NewKeyring(
+		auth.Key{Id: "session-2", Secret: []byte("rotated-session-key")},
+		auth.Key{Id: "session-1", Secret: []byte(testSessionKey), ExpiresAt: ts.now.Add(time.Hour)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.Now = func() time.Time { return ts.now }
+	ts.server.SessionKeys = keys
+
+	if rec := ts.request(http.MethodGet, "/api/v1/users", oldToken, nil); rec.Code != http.StatusOK {
+		t.Errorf("旧鍵のトークン: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	newToken := ts.login("test1@test.co.jp")
+	if rec := ts.request(http.MethodGet, "/api/v1/users", newToken, nil); rec.Code != http.StatusOK {
+		t.Errorf("新鍵のトークン: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	// 旧鍵の検証期限を過ぎたら受け付けない
+	ts.now = ts.now.Add(2 * time.Hour)
+	if rec := ts.request(http.MethodGet, "/api/v1/users", oldToken, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("期限切れの旧鍵のトークン: ステータスコード: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+
+	rec := ts.request(http.MethodGet, "/api/v1/users", token, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestQrToken(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+
+	first := ts.qrToken(token)
+	if first == "" {
+		t.Fatal("QRトークンが返却されていない")
+	}
+	if second := ts.qrToken(token); second != first {
+		t.Errorf("2回目の取得で別のQRトークンが返却された: %s, %s", first, second)
+	}
+}
+
+func TestFaceRecognition(t *testing.T) {
+	tests := []struct {
+		name  string
+		photo string
+		want  bool
+	}{
+		{name: "本人", photo: "match.png", want: true},
+		{name: "別人", photo: "mismatch.png", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+			token := ts.login("test1@test.co.jp")
+			qrToken := ts.qrToken(token)
+
+			rec := ts.request(http.MethodPost, "/api/v1/face-recognition", ts.kiosk(), map[string]string{
+				"qrToken": qrToken,
+				"photo":   fixturePhoto(t, tt.photo),
+			})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+			}
+			var res struct {
+				AuthResult bool `json:"authResult"`
+			}
+			decode(t, rec, &res)
+			if res.AuthResult != tt.want {
+				t.Errorf("認証結果: got %v, want %v", res.AuthResult, tt.want)
+			}
+			// 結果は認証の成否によらず記録される
+			var count int
+			ts.server.DB.Model(&model.FaceRecognitionResult{}).Count(&count)
+			if count != 1 {
+				t.Errorf("顔認証結果の件数: got %d, want 1", count)
+			}
+		})
+	}
+}
+
+func TestFaceRecognitionScripted(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.login("test1@test.co.jp")
+	qrToken := ts.qrToken(token)
+
+	// 別の画像でも台本で一致させられる
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	photo := fixturePhoto(t, "mismatch.png")
+	ts.matcher.SetSimilarity(user.S3Key, "sha256:0fdd48c5f8baa6978f70b75a44ae207cb8df6c801e1b17a2d2e072d767a040a2", 95)
+
+	rec := ts.request(http.MethodPost, "/api/v1/face-recognition", ts.kiosk(), map[string]string{
+		"qrToken": qrToken,
+		"photo":   photo,
+	})
+	var res struct {
+		AuthResult bool `json:"authResult"`
+	}
+	decode(t, rec, &res)
+	if !res.AuthResult {
+		t.Errorf("台本どおりに一致しなかった: %s", rec.Body.String())
+	}
+}
+
+func TestFaceRecognitionFailure(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	token := ts.kiosk()
+	photo := fixturePhoto(t, "match.png")
+
+	t.Run("バリデーション", func(t *testing.T) {
+		rec := ts.request(http.MethodPost, "/api/v1/face-recognition", token, map[string]string{"photo": "@@@"})
+		assertMessages(t, rec, []string{"QRトークンは必須項目です", "写真のフォーマットが不正です"})
+	})
+	t.Run("QRトークン不正", func(t *testing.T) {
+		rec := ts.request(http.MethodPost, "/api/v1/face-recognition", token, map[string]string{
+			"qrToken": "invalid",
+			"photo":   photo,
+		})
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+		}
+		var res struct {
+			Message string `json:"message"`
+		}
+		decode(t, rec, &res)
+		if res.Message != "QRトークンのフォーマットが不正のため、特定できませんでした" {
+			t.Errorf("エラーメッセージ: got %s", res.Message)
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package route
+
+import (
+	"face-recognition/model"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+// ログインしてアクセストークンとリフレッシュトークンを取得
+func (ts *testServer) loginTokens(email string) tokenResponse {
+	ts.t.Helper()
+	rec := ts.request(http.MethodPost, "/api/v1/users/login", "", map[string]string{
+		"email":    email,
+		"password": "Password123",
+	})
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("ログイン失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var res tokenResponse
+	decode(ts.t, rec, &res)
+	return res
+}
+
+func (ts *testServer) refresh(refreshToken string) (tokenResponse, int) {
+	ts.t.Helper()
+	rec := ts.request(http.MethodPost, "/api/v1/users/refresh", "", map[string]string{
+		"refreshToken": refreshToken,
+	})
+	var res tokenResponse
+	if rec.Code == http.StatusOK {
+		decode(ts.t, rec, &res)
+	}
+	return res, rec.Code
+}
+
+func TestRefreshRotation(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	login := ts.loginTokens("test1@test.co.jp")
+	if login.RefreshToken == "" || login.ExpiresIn != int64((15*time.Minute).Seconds()) {
+		t.Fatalf("ログインのレスポンスが不正: %+v", login)
+	}
+
+	refreshed, code := ts.refresh(login.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("トークン更新: ステータスコード: got %d", code)
+	}
+	if refreshed.RefreshToken == login.RefreshToken {
+		t.Error("リフレッシュトークンがローテーションされていない")
+	}
+	if rec := ts.request(http.MethodGet, "/api/v1/users", refreshed.Token, nil); rec.Code != http.StatusOK {
+		t.Errorf("更新後のアクセストークン: ステータスコード: got %d", rec.Code)
+	}
+
+	// 使用済みのリフレッシュトークンの再利用はセッションごと失効させる
+	if _, code := ts.refresh(login.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("使用済みのトークン: ステータスコード: got %d, want %d", code, http.StatusUnauthorized)
+	}
+	if _, code := ts.refresh(refreshed.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("失効したセッションのトークン: ステータスコード: got %d, want %d", code, http.StatusUnauthorized)
+	}
+	if rec := ts.request(http.MethodGet, "/api/v1/users", refreshed.Token, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("失効したセッションのアクセストークン: ステータスコード: got %d", rec.Code)
+	}
+}
+
+func TestRefreshExpired(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	login := ts.loginTokens("test1@test.co.jp")
+
+	ts.now = ts.now.Add(31 * 24 * time.Hour)
+	if _, code := ts.refresh(login.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("期限切れのトークン: ステータスコード: got %d, want %d", code, http.StatusUnauthorized)
+	}
+	if _, code := ts.refresh("invalid"); code != http.StatusUnauthorized {
+		t.Errorf("不正なトークン: ステータスコード: got %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	login := ts.loginTokens("test1@test.co.jp")
+	other := ts.loginTokens("test1@test.co.jp")
+
+	if rec := ts.request(http.MethodPost, "/api/v1/users/logout", login.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	// ログアウトしたセッションのトークンは期限内でも使えない
+	if rec := ts.request(http.MethodGet, "/api/v1/users", login.Token, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("アクセストークン: ステータスコード: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if _, code := ts.refresh(login.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("リフレッシュトークン: ステータスコード: got %d, want %d", code, http.StatusUnauthorized)
+	}
+	// 他のセッションには影響しない
+	if rec := ts.request(http.MethodGet, "/api/v1/users", other.Token, nil); rec.Code != http.StatusOK {
+		t.Errorf("他のセッション: ステータスコード: got %d", rec.Code)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("test2@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	login := ts.loginTokens("test1@test.co.jp")
+	other := ts.loginTokens("test1@test.co.jp")
+	another := ts.loginTokens("test2@test.co.jp")
+
+	rec := ts.request(http.MethodGet, "/api/v1/users/sessions", login.Token, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	var sessions []model.UserSession
+	decode(t, rec, &sessions)
+	if len(sessions) != 2 || !sessions[0].Current || sessions[1].Current {
+		t.Fatalf("セッション一覧: got %+v", sessions)
+	}
+
+	// 他のユーザのセッションは失効できない
+	var anotherSessions []model.UserSession
+	decode(t, ts.request(http.MethodGet, "/api/v1/users/sessions", another.Token, nil), &anotherSessions)
+	if rec := ts.request(http.MethodDelete, "/api/v1/users/sessions/"+anotherSessions[0].SessionId, login.Token, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("他のユーザのセッション: ステータスコード: got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// 他の端末のセッションを失効させる
+	if rec := ts.request(http.MethodDelete, "/api/v1/users/sessions/"+sessions[1].SessionId, login.Token, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("セッション失効: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	if rec := ts.request(http.MethodGet, "/api/v1/users", other.Token, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("失効したセッション: ステータスコード: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	decode(t, ts.request(http.MethodGet, "/api/v1/users/sessions", login.Token, nil), &sessions)
+	if len(sessions) != 1 {
+		t.Errorf("失効後のセッション一覧: got %+v", sessions)
+	}
+}
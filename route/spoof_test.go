@@ -0,0 +1,98 @@
+package route
+
+import (
+	"errors"
+	"face-recognition/model"
+	"net/http"
+	"testing"
+)
+
+// 決まったスコアを返すなりすまし検知エンジン（外部エンジンの代わり）
+type stubDetector struct {
+	score float64
+	err   error
+}
+
+func (d *stubDetector) Score(image []byte) (float64, error) {
+	return d.score, d.err
+}
+
+func TestRecognitionSpoofScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		detector *stubDetector
+		code     int
+		outcome  string
+		score    *float64
+	}{
+		{name: "検知なし", code: http.StatusOK, outcome: model.OutcomeMatched},
+		{name: "しきい値以下", detector: &stubDetector{score: 50}, code: http.StatusOK, outcome: model.OutcomeMatched, score: floatPtr(50)},
+		{name: "しきい値超え", detector: &stubDetector{score: 72.5}, code: http.StatusOK, outcome: model.OutcomeSpoofSuspected, score: floatPtr(72.5)},
+		{name: "検知エラー", detector: &stubDetector{err: errors.New("timeout")}, code: http.StatusInternalServerError, outcome: model.OutcomeBackendError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			if tt.detector != nil {
+				ts.server.Spoof = tt.detector
+			}
+			ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+			qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+			kiosk := ts.kiosk()
+
+			rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+				"qrToken": qrToken,
+				"photo":   fixturePhoto(t, "match.png"),
+			})
+			var res struct {
+				AuthResult bool   `json:"authResult"`
+				Outcome    string `json:"outcome"`
+			}
+			decode(t, rec, &res)
+			if rec.Code != tt.code || res.Outcome != tt.outcome || res.AuthResult != (tt.outcome == model.OutcomeMatched) {
+				t.Errorf("顔認証: got %d %+v", rec.Code, res)
+			}
+			result := model.FaceRecognitionResult{}
+			ts.server.DB.Order("id DESC").First(&result)
+			if result.Outcome != tt.outcome {
+				t.Errorf("結果の種類: got %s, want %s", result.Outcome, tt.outcome)
+			}
+			if (result.SpoofScore == nil) != (tt.score == nil) || (tt.score != nil && *result.SpoofScore != *tt.score) {
+				t.Errorf("なりすましスコア: got %v, want %v", result.SpoofScore, tt.score)
+			}
+		})
+	}
+}
+
+func TestIdentificationSpoofScore(t *testing.T) {
+	ts := newTestServer(t)
+	detector := &stubDetector{score: 20}
+	ts.server.Spoof = detector
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	kiosk := ts.kiosk()
+
+	if res := ts.identify(kiosk, fixturePhoto(t, "match.png")); !res.Identified {
+		t.Fatalf("顔識別: got %+v", res)
+	}
+	result := model.FaceRecognitionResult{}
+	ts.server.DB.Order("id DESC").First(&result)
+	if result.SpoofScore == nil || *result.SpoofScore != 20 {
+		t.Errorf("なりすましスコア: got %v", result.SpoofScore)
+	}
+
+	// しきい値を超えると本人と特定しない
+	detector.score = 90
+	rec := ts.request(http.MethodPost, "/api/v1/face-identification", kiosk, map[string]string{"photo": fixturePhoto(t, "match.png")})
+	var res struct {
+		Identified bool   `json:"identified"`
+		Outcome    string `json:"outcome"`
+	}
+	decode(t, rec, &res)
+	if rec.Code != http.StatusOK || res.Identified || res.Outcome != model.OutcomeSpoofSuspected {
+		t.Errorf("顔識別: got %d %+v", rec.Code, res)
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,260 @@
+package route
+
+import (
+	"face-recognition/auth"
+	"face-recognition/model"
+	"net/http"
+	"testing"
+)
+
+// 別人の画像（mismatch.png）のハッシュ値
+const mismatchImageId = "sha256:0fdd48c5f8baa6978f70b75a44ae207cb8df6c801e1b17a2d2e072d767a040a2"
+
+type recognitionResponse struct {
+	AuthResult bool   `json:"authResult"`
+	Decision   string `json:"decision"`
+}
+
+// 設置場所を指定して顔認証し、最新の顔認証結果とあわせて返す
+func (ts *testServer) recognize(kiosk string, qrToken string, photo string, location string) (recognitionResponse, model.FaceRecognitionResult) {
+	ts.t.Helper()
+	rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+		"qrToken":  qrToken,
+		"photo":    photo,
+		"location": location,
+	})
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("顔認証: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	var res recognitionResponse
+	decode(ts.t, rec, &res)
+	result := model.FaceRecognitionResult{}
+	ts.server.DB.Order("id DESC").First(&result)
+	return res, result
+}
+
+// 顔認証端末の設置場所を設定
+func (ts *testServer) setLocation(admin string, email string, location string) {
+	ts.t.Helper()
+	rec := ts.request(http.MethodPut, ts.userPath(email)+"/location", admin, map[string]string{"location": location})
+	if rec.Code != http.StatusOK {
+		ts.t.Fatalf("設置場所の設定: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+}
+
+func TestThresholdPolicy(t *testing.T) {
+	ts := newTestServer(t)
+	// 同じQRトークンで繰り返し顔認証する
+	ts.server.QrTokenMaxUses = 0
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+	admin := ts.login("admin@test.co.jp")
+	qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+	kiosk := ts.kiosk()
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	ts.matcher.SetSimilarity(user.S3Key, mismatchImageId, 85)
+	photo := fixturePhoto(t, "mismatch.png")
+
+	tests := []struct {
+		name     string
+		setup    func()
+		location string
+		decision string
+		accept   float64
+		review   float64
+		scope    string
+	}{
+		{name: "全体のデフォルト", location: "gate-a", decision: "review", accept: 90, review: 80, scope: "default"},
+		{
+			name: "設置場所の設定",
+			setup: func() {
+				rec := ts.request(http.MethodPut, "/api/v1/thresholds/locations/gate-a", admin, map[string]float64{"acceptThreshold": 85, "reviewThreshold": 70})
+				if rec.Code != http.StatusOK {
+					t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+				}
+			},
+			location: "gate-a", decision: "accept", accept: 85, review: 70, scope: "location",
+		},
+		{name: "別の設置場所", location: "gate-b", decision: "review", accept: 90, review: 80, scope: "default"},
+		{
+			name: "ユーザ個別の設定",
+			setup: func() {
+				rec := ts.request(http.MethodPut, ts.userPath("test1@test.co.jp")+"/threshold", admin, map[string]float64{"acceptThreshold": 99, "reviewThreshold": 95})
+				if rec.Code != http.StatusOK {
+					t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+				}
+			},
+			location: "gate-a", decision: "reject", accept: 99, review: 95, scope: "user",
+		},
+		{
+			name: "ユーザ個別の設定の削除",
+			setup: func() {
+				if rec := ts.request(http.MethodDelete, ts.userPath("test1@test.co.jp")+"/threshold", admin, nil); rec.Code != http.StatusOK {
+					t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+				}
+			},
+			location: "gate-a", decision: "accept", accept: 85, review: 70, scope: "location",
+		},
+	}
+	for _, tt := range tests {
+		if tt.setup != nil {
+			tt.setup()
+		}
+		ts.setLocation(admin, "kiosk@test.co.jp", tt.location)
+		res, result := ts.recognize(kiosk, qrToken, photo, tt.location)
+		if res.Decision != tt.decision || res.AuthResult != (tt.decision == "accept") {
+			t.Errorf("%s: 判定: got %+v, want %s", tt.name, res, tt.decision)
+		}
+		// 判定に使ったしきい値を結果に記録する
+		if result.Decision != tt.decision || result.AcceptThreshold != tt.accept || result.ReviewThreshold != tt.review ||
+			result.ThresholdScope != tt.scope || result.Location != tt.location || result.Result != 85 {
+			t.Errorf("%s: 顔認証結果: got %+v", tt.name, result)
+		}
+	}
+
+	rec := ts.request(http.MethodGet, "/api/v1/thresholds", admin, nil)
+	var thresholds struct {
+		Default struct {
+			AcceptThreshold float64 `json:"acceptThreshold"`
+			ReviewThreshold float64 `json:"reviewThreshold"`
+		} `json:"default"`
+		Locations []model.LocationThreshold `json:"locations"`
+	}
+	decode(t, rec, &thresholds)
+	if thresholds.Default.AcceptThreshold != 90 || len(thresholds.Locations) != 1 || thresholds.Locations[0].Location != "gate-a" {
+		t.Errorf("しきい値の一覧: got %+v", thresholds)
+	}
+	if rec := ts.request(http.MethodDelete, "/api/v1/thresholds/locations/gate-a", admin, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("設置場所の設定の削除: ステータスコード: got %d", rec.Code)
+	}
+	if rec := ts.request(http.MethodDelete, "/api/v1/thresholds/locations/gate-a", admin, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("未設定の設置場所の削除: ステータスコード: got %d", rec.Code)
+	}
+}
+
+func TestThresholdValidation(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+	admin := ts.login("admin@test.co.jp")
+
+	if rec := ts.request(http.MethodGet, "/api/v1/thresholds", ts.login("test1@test.co.jp"), nil); rec.Code != http.StatusForbidden {
+		t.Errorf("一般ユーザ: ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	rec := ts.request(http.MethodPut, "/api/v1/thresholds/locations/gate-a", admin, map[string]float64{"acceptThreshold": 101})
+	assertMessages(t, rec, []string{"本人と判定するしきい値は0〜100で指定してください", "要確認のしきい値は0〜100で指定してください"})
+	rec = ts.request(http.MethodPut, ts.userPath("test1@test.co.jp")+"/threshold", admin, map[string]float64{"acceptThreshold": 80, "reviewThreshold": 90})
+	assertMessages(t, rec, []string{"要確認のしきい値は本人と判定するしきい値以下で指定してください"})
+	rec = ts.request(http.MethodPost, "/api/v1/face-recognition", ts.kiosk(), map[string]string{
+		"qrToken":  "token",
+		"photo":    fixturePhoto(t, "match.png"),
+		"location": "12345678901234567890123456789012345678901234567890123456789012345",
+	})
+	assertMessages(t, rec, []string{"設置場所は64文字以内で指定してください"})
+}
+
+func TestIdentificationReview(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	kiosk := ts.kiosk()
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	ts.matcher.SetSimilarity(user.S3Key, mismatchImageId, 85)
+
+	// 要確認の場合は本人と特定せず、候補を返して結果を記録する
+	res := ts.identify(kiosk, fixturePhoto(t, "mismatch.png"))
+	if res.Identified || res.Decision != "review" || res.UserId != user.Id {
+		t.Errorf("識別結果: got %+v", res)
+	}
+	result := model.FaceRecognitionResult{}
+	ts.server.DB.Find(&result)
+	if result.Decision != "review" || result.Method != model.RecognitionMethodIdentification {
+		t.Errorf("顔認証結果: got %+v", result)
+	}
+}
+
+func TestThresholdZeroAccept(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+	admin := ts.login("admin@test.co.jp")
+
+	rec := ts.request(http.MethodPut, "/api/v1/thresholds/locations/gate-a", admin, map[string]float64{"acceptThreshold": 0, "reviewThreshold": 0})
+	assertMessages(t, rec, []string{"本人と判定するしきい値は0より大きい値で指定してください"})
+
+	// 検証の導入前に登録した設定でも、顔を比較できなかった場合は本人と判定しない
+	ts.server.DB.Create(&model.LocationThreshold{Location: "gate-a"})
+	qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+	probe := fixturePhoto(t, "match.png")
+	ts.matcher.SetFaces(imageHash(t, probe), 0)
+	kiosk := ts.kiosk()
+	ts.setLocation(admin, "kiosk@test.co.jp", "gate-a")
+	res, result := ts.recognize(kiosk, qrToken, probe, "gate-a")
+	if res.AuthResult || res.Decision != "reject" {
+		t.Errorf("判定: got %+v, want reject", res)
+	}
+	if result.Decision != "reject" || result.Outcome != model.OutcomeNoFaceDetected || result.ThresholdScope != "location" || result.AcceptThreshold != 0 {
+		t.Errorf("顔認証結果: got %+v", result)
+	}
+	// QRトークンは使用済みにしない
+	token := model.QrToken{}
+	ts.server.DB.Find(&token)
+	if token.UseCount != 0 {
+		t.Errorf("QRトークンの使用回数: got %d, want 0", token.UseCount)
+	}
+}
+
+func TestKioskLocation(t *testing.T) {
+	ts := newTestServer(t)
+	ts.server.QrTokenMaxUses = 0
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+	admin := ts.login("admin@test.co.jp")
+	qrToken := ts.qrToken(ts.login("test1@test.co.jp"))
+	kiosk := ts.kiosk()
+	user := model.MstUser{}
+	ts.server.DB.Where("email = ?", "test1@test.co.jp").Find(&user)
+	ts.matcher.SetSimilarity(user.S3Key, mismatchImageId, 85)
+	photo := fixturePhoto(t, "mismatch.png")
+	if rec := ts.request(http.MethodPut, "/api/v1/thresholds/locations/gate-a", admin, map[string]float64{"acceptThreshold": 85, "reviewThreshold": 70}); rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+
+	// 設置場所は顔認証端末にのみ設定できる
+	rec := ts.request(http.MethodPut, ts.userPath("test1@test.co.jp")+"/location", admin, map[string]string{"location": "gate-a"})
+	assertMessages(t, rec, []string{"設置場所はkioskロールのユーザにのみ設定できます"})
+
+	// 設置場所を省略しても端末の設置場所のしきい値を適用する
+	ts.setLocation(admin, "kiosk@test.co.jp", "gate-a")
+	res, result := ts.recognize(kiosk, qrToken, photo, "")
+	if res.Decision != "accept" || result.Location != "gate-a" || result.ThresholdScope != "location" {
+		t.Errorf("端末の設置場所: got %+v / %+v", res, result)
+	}
+	// 端末の設定と異なる設置場所は受け付けない
+	rec = ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+		"qrToken":  qrToken,
+		"photo":    photo,
+		"location": "gate-b",
+	})
+	assertMessages(t, rec, []string{"設置場所が端末の設定と一致しません"})
+	rec = ts.request(http.MethodPost, "/api/v1/face-identification", kiosk, map[string]string{
+		"photo":    photo,
+		"location": "gate-b",
+	})
+	assertMessages(t, rec, []string{"設置場所が端末の設定と一致しません"})
+
+	// 顔認証端末でなくなったら設置場所を解除する
+	if rec := ts.request(http.MethodPut, ts.userPath("kiosk@test.co.jp")+"/role", admin, map[string]string{"role": "member"}); rec.Code != http.StatusOK {
+		t.Fatalf("ロール変更: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	kioskUser := model.MstUser{}
+	ts.server.DB.Where("email = ?", "kiosk@test.co.jp").Find(&kioskUser)
+	if kioskUser.Location != "" {
+		t.Errorf("設置場所: got %s, want empty", kioskUser.Location)
+	}
+}
@@ -0,0 +1,111 @@
+package route
+
+import (
+	"face-recognition/auth"
+	"face-recognition/model"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// 一覧取得用のユーザを登録（作成日時は1日ずつずらす）
+func newUserListTestServer(t *testing.T) (*testServer, string) {
+	t.Helper()
+	ts := newTestServer(t)
+	ts.register("admin@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+	for i := 1; i <= 4; i++ {
+		ts.register(fmt.Sprintf("user%d@test.co.jp", i), fixturePhoto(t, "match.png"))
+	}
+	ts.server.DB.Model(&model.MstUser{}).Where("email = ?", "user4@test.co.jp").Update("status", model.UserStatusSuspended)
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var users []model.MstUser
+	ts.server.DB.Order("id").Find(&users)
+	for i, user := range users {
+		ts.server.DB.Model(&user).UpdateColumn("created_at", base.AddDate(0, 0, i))
+	}
+	return ts, ts.login("admin@test.co.jp")
+}
+
+func (ts *testServer) userList(token string, query url.Values) (model.UserList, int) {
+	ts.t.Helper()
+	rec := ts.request(http.MethodGet, "/api/v1/users?"+query.Encode(), token, nil)
+	var list model.UserList
+	if rec.Code == http.StatusOK {
+		decode(ts.t, rec, &list)
+	}
+	return list, rec.Code
+}
+
+func emails(users []model.MstUser) []string {
+	var res []string
+	for _, u := range users {
+		res = append(res, u.Email)
+	}
+	return res
+}
+
+func TestUserListPagination(t *testing.T) {
+	ts, admin := newUserListTestServer(t)
+
+	list, _ := ts.userList(admin, url.Values{"page": {"2"}, "perPage": {"2"}})
+	if list.Total != 5 || list.Page != 2 || list.PerPage != 2 || list.TotalPages != 3 {
+		t.Errorf("ページ情報: got %+v", list)
+	}
+	if got := fmt.Sprint(emails(list.Items)); got != "[user2@test.co.jp user3@test.co.jp]" {
+		t.Errorf("2ページ目: got %s", got)
+	}
+	// 範囲外のページは空の配列
+	list, _ = ts.userList(admin, url.Values{"page": {"9"}})
+	if list.Items == nil || len(list.Items) != 0 || list.Total != 5 {
+		t.Errorf("範囲外のページ: got %+v", list)
+	}
+}
+
+func TestUserListFilterAndSort(t *testing.T) {
+	ts, admin := newUserListTestServer(t)
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  string
+	}{
+		{name: "メールアドレス", query: url.Values{"email": {"user1"}}, want: "[user1@test.co.jp]"},
+		{name: "LIKEの特殊文字はエスケープする", query: url.Values{"email": {"%"}}, want: "[]"},
+		{name: "管理者", query: url.Values{"admin": {"true"}}, want: "[admin@test.co.jp]"},
+		{name: "状態", query: url.Values{"status": {"suspended"}}, want: "[user4@test.co.jp]"},
+		{name: "作成日時", query: url.Values{"createdFrom": {"2020-01-02T00:00:00Z"}, "createdTo": {"2020-01-04T00:00:00Z"}}, want: "[user1@test.co.jp user2@test.co.jp]"},
+		{name: "降順", query: url.Values{"sort": {"-createdAt"}, "perPage": {"2"}}, want: "[user4@test.co.jp user3@test.co.jp]"},
+		{name: "ユーザ名が同じ場合はid順", query: url.Values{"sort": {"username"}, "username": {"テスト"}}, want: "[admin@test.co.jp user1@test.co.jp user2@test.co.jp user3@test.co.jp user4@test.co.jp]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, code := ts.userList(admin, tt.query)
+			if code != http.StatusOK {
+				t.Fatalf("ステータスコード: got %d", code)
+			}
+			if got := fmt.Sprint(emails(list.Items)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserListValidation(t *testing.T) {
+	ts, admin := newUserListTestServer(t)
+	query := url.Values{
+		"perPage":     {"101"},
+		"status":      {"deleted"},
+		"createdFrom": {"2020-01-01"},
+		"sort":        {"password"},
+	}
+	rec := ts.request(http.MethodGet, "/api/v1/users?"+query.Encode(), admin, nil)
+	assertMessages(t, rec, []string{
+		"1ページあたりの件数は1〜100を指定してください",
+		"状態はactive、suspendedのいずれかを指定してください",
+		"作成日時（開始）の形式が不正です",
+		"並び替えに指定できない項目です（password）",
+	})
+}
@@ -0,0 +1,237 @@
+package route
+
+import (
+	"face-recognition/auth"
+	"face-recognition/model"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// メールアドレスからユーザのパスを取得
+func (ts *testServer) userPath(email string) string {
+	ts.t.Helper()
+	user := model.MstUser{}
+	ts.server.DB.Unscoped().Where("email = ?", email).Find(&user)
+	if user.Id == 0 {
+		ts.t.Fatalf("ユーザが存在しない: %s", email)
+	}
+	return "/api/v1/users/" + strconv.FormatFloat(user.Id, 'f', -1, 64)
+}
+
+func TestMe(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	login := ts.loginTokens("test1@test.co.jp")
+	other := ts.loginTokens("test1@test.co.jp")
+
+	rec := ts.request(http.MethodGet, "/api/v1/users/me", login.Token, nil)
+	var me model.MstUser
+	decode(t, rec, &me)
+	if me.Email != "test1@test.co.jp" || me.Status != model.UserStatusActive || me.Role != "member" {
+		t.Fatalf("ユーザ情報: got %+v", me)
+	}
+
+	// ユーザ名は現在のパスワードなしで変更できる
+	rec = ts.request(http.MethodPatch, "/api/v1/users/me", login.Token, map[string]string{"username": "テスト次郎"})
+	decode(t, rec, &me)
+	if rec.Code != http.StatusOK || me.Username != "テスト次郎" {
+		t.Errorf("ユーザ名変更: got %d %+v", rec.Code, me)
+	}
+	// パスワードの変更には現在のパスワードが必要
+	rec = ts.request(http.MethodPatch, "/api/v1/users/me", login.Token, map[string]string{"password": "NewPassword"})
+	assertMessages(t, rec, []string{"現在のパスワードが違います"})
+	rec = ts.request(http.MethodPatch, "/api/v1/users/me", login.Token, map[string]string{
+		"password":        "NewPassword",
+		"currentPassword": "Password123",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("パスワード変更: ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	// 他の端末のセッションは失効し、現在のセッションは継続する
+	if rec := ts.request(http.MethodGet, "/api/v1/users/me", other.Token, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("他のセッション: ステータスコード: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := ts.request(http.MethodGet, "/api/v1/users/me", login.Token, nil); rec.Code != http.StatusOK {
+		t.Errorf("現在のセッション: ステータスコード: got %d", rec.Code)
+	}
+	// ロール・状態は自身では変更できない（項目として受け付けない）
+	ts.request(http.MethodPatch, "/api/v1/users/me", login.Token, map[string]string{"role": "admin", "status": "suspended"})
+	decode(t, ts.request(http.MethodGet, "/api/v1/users/me", login.Token, nil), &me)
+	if me.Role != "member" || me.Status != model.UserStatusActive {
+		t.Errorf("ロール・状態が変更された: %+v", me)
+	}
+}
+
+func TestPatchMeValidation(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("test2@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	token := ts.login("test1@test.co.jp")
+
+	rec := ts.request(http.MethodPatch, "/api/v1/users/me", token, map[string]string{
+		"email":    "invalid",
+		"username": "12345678901234567",
+	})
+	assertMessages(t, rec, []string{"メールアドレスのフォーマットが不正です", "ユーザー名は1〜16文字で入力してください"})
+	rec = ts.request(http.MethodPatch, "/api/v1/users/me", token, map[string]string{
+		"email":           "test2@test.co.jp",
+		"currentPassword": "Password123",
+	})
+	assertMessages(t, rec, []string{"既に存在するメールアドレスです"})
+}
+
+func TestManageUser(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+	admin := ts.login("admin@test.co.jp")
+	member := ts.login("test1@test.co.jp")
+	path := ts.userPath("test1@test.co.jp")
+
+	if rec := ts.request(http.MethodGet, path, member, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("一般ユーザによる参照: ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	rec := ts.request(http.MethodGet, path, admin, nil)
+	var user model.MstUser
+	decode(t, rec, &user)
+	if user.Email != "test1@test.co.jp" {
+		t.Fatalf("ユーザ情報: got %+v", user)
+	}
+	if rec := ts.request(http.MethodGet, "/api/v1/users/9999", admin, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("存在しないユーザ: ステータスコード: got %d", rec.Code)
+	}
+
+	rec = ts.request(http.MethodPatch, path, admin, map[string]string{"status": "deleted"})
+	assertMessages(t, rec, []string{"状態はactive、suspendedのいずれかを指定してください"})
+	rec = ts.request(http.MethodPatch, path, admin, map[string]string{"username": "変更後"})
+	decode(t, rec, &user)
+	if user.Username != "変更後" {
+		t.Errorf("ユーザ名変更: got %+v", user)
+	}
+	rec = ts.request(http.MethodPatch, ts.userPath("admin@test.co.jp"), admin, map[string]string{"status": "suspended"})
+	assertMessages(t, rec, []string{"自身を利用停止にはできません"})
+}
+
+func TestSuspendUser(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+	admin := ts.login("admin@test.co.jp")
+	member := ts.loginTokens("test1@test.co.jp")
+	qrToken := ts.qrToken(member.Token)
+	kiosk := ts.kiosk()
+
+	rec := ts.request(http.MethodPatch, ts.userPath("test1@test.co.jp"), admin, map[string]string{"status": "suspended"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	// 発行済みのトークンは失効し、再ログイン・更新もできない
+	if rec := ts.request(http.MethodGet, "/api/v1/users/me", member.Token, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("アクセストークン: ステータスコード: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if _, code := ts.refresh(member.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("リフレッシュトークン: ステータスコード: got %d, want %d", code, http.StatusUnauthorized)
+	}
+	rec = ts.request(http.MethodPost, "/api/v1/users/login", "", map[string]string{
+		"email":    "test1@test.co.jp",
+		"password": "Password123",
+	})
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("ログイン: ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	// 顔認証もできず、結果も記録しない
+	rec = ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+		"qrToken": qrToken,
+		"photo":   fixturePhoto(t, "match.png"),
+	})
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("顔認証: ステータスコード: got %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	var count int
+	ts.server.DB.Model(&model.FaceRecognitionResult{}).Count(&count)
+	if count != 0 {
+		t.Errorf("顔認証結果の件数: got %d, want 0", count)
+	}
+
+	// 再開すればログインできる
+	ts.request(http.MethodPatch, ts.userPath("test1@test.co.jp"), admin, map[string]string{"status": "active"})
+	ts.login("test1@test.co.jp")
+}
+
+func TestDeleteUser(t *testing.T) {
+	ts := newTestServer(t)
+	ts.register("test1@test.co.jp", fixturePhoto(t, "match.png"))
+	ts.register("admin@test.co.jp", fixturePhoto(t, "mismatch.png"))
+	ts.setRole("admin@test.co.jp", auth.RoleAdmin)
+	admin := ts.login("admin@test.co.jp")
+	member := ts.login("test1@test.co.jp")
+	qrToken := ts.qrToken(member)
+	kiosk := ts.kiosk()
+
+	// 削除前の顔認証結果
+	ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+		"qrToken": qrToken,
+		"photo":   fixturePhoto(t, "match.png"),
+	})
+
+	enrollment := model.FaceEnrollment{}
+	ts.server.DB.Joins("JOIN mst_user ON mst_user.id = face_enrollment.mst_user_id").Where("mst_user.email = ?", "test1@test.co.jp").Find(&enrollment)
+	if enrollment.FaceId == "" || !ts.matcher.Indexed(enrollment.FaceId) {
+		t.Fatalf("顔写真が索引に登録されていない: %+v", enrollment)
+	}
+
+	path := ts.userPath("test1@test.co.jp")
+	if rec := ts.request(http.MethodDelete, ts.userPath("admin@test.co.jp"), admin, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("自身の削除: ステータスコード: got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := ts.request(http.MethodDelete, path, admin, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("ステータスコード: got %d (%s)", rec.Code, rec.Body.String())
+	}
+	if rec := ts.request(http.MethodGet, path, admin, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("削除後の参照: ステータスコード: got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := ts.request(http.MethodGet, "/api/v1/users/me", member, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("削除後のアクセストークン: ステータスコード: got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec := ts.request(http.MethodPost, "/api/v1/face-recognition", kiosk, map[string]string{
+		"qrToken": qrToken,
+		"photo":   fixturePhoto(t, "match.png"),
+	})
+	if rec.Code == http.StatusOK {
+		t.Error("削除後に顔認証できた")
+	}
+
+	// 論理削除のため、顔認証結果の履歴とユーザのレコードは残る
+	var count int
+	ts.server.DB.Model(&model.FaceRecognitionResult{}).Count(&count)
+	if count != 1 {
+		t.Errorf("顔認証結果の件数: got %d, want 1", count)
+	}
+	user := model.MstUser{}
+	ts.server.DB.Unscoped().Where("email = ?", "test1@test.co.jp").Find(&user)
+	if user.DeletedAt == nil {
+		t.Error("削除日時が記録されていない")
+	}
+	// 顔写真は利用終了にし、顔検索の索引から削除する
+	if ts.matcher.Indexed(enrollment.FaceId) {
+		t.Error("削除したユーザの顔が索引に残っている")
+	}
+	ts.server.DB.Where("id = ?", enrollment.Id).Find(&enrollment)
+	if enrollment.Active || enrollment.DeactivatedAt == nil || enrollment.FaceId != "" {
+		t.Errorf("削除したユーザの顔写真: got %+v", enrollment)
+	}
+	if res := ts.identify(kiosk, fixturePhoto(t, "match.png")); res.Identified {
+		t.Errorf("削除したユーザを特定した: %+v", res)
+	}
+	// 削除済みユーザのメールアドレスでは登録できない
+	rec = ts.request(http.MethodPost, "/api/v1/users/register", "", map[string]string{
+		"email":    "test1@test.co.jp",
+		"username": "テスト太郎",
+		"password": "Password123",
+		"photo":    fixturePhoto(t, "match.png"),
+	})
+	assertMessages(t, rec, []string{"既に存在するメールアドレスです"})
+}
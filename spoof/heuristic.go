@@ -0,0 +1,109 @@
+package spoof
+
+import (
+	"bytes"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"sort"
+)
+
+// 解析する画素の最大数（長辺をこの画素数程度に間引く）
+const heuristicSampleSize = 256
+
+// 画素値から判定するローカルのなりすまし検知エンジン
+// 画面の再撮影に出やすい画素格子のモアレ（高周波成分）、光沢面の反射（白飛び）、
+// 印刷物に出やすい明るさの幅の狭さをそれぞれ0-1で評価し、重み付きで合算する
+// 学習済みのモデルではないため、しきい値は運用環境の写真で調整する
+type HeuristicDetector struct {
+	// 各特徴の重み（合計1）
+	MoireWeight float64
+	GlareWeight float64
+	RangeWeight float64
+}
+
+func NewHeuristicDetector() *HeuristicDetector {
+	return &HeuristicDetector{MoireWeight: 0.4, GlareWeight: 0.3, RangeWeight: 0.3}
+}
+
+func (d *HeuristicDetector) Score(data []byte) (float64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	luma := sampleLuma(img)
+	if len(luma) == 0 || len(luma[0]) < 3 {
+		return 0, nil
+	}
+	score := d.MoireWeight*moireScore(luma) + d.GlareWeight*glareScore(luma) + d.RangeWeight*rangeScore(luma)
+	return math.Round(clamp(score)*100*100) / 100, nil
+}
+
+// 画像を間引いて輝度（0-1）の2次元配列にする
+func sampleLuma(img image.Image) [][]float64 {
+	bounds := img.Bounds()
+	step := bounds.Dx()
+	if bounds.Dy() > step {
+		step = bounds.Dy()
+	}
+	step = step / heuristicSampleSize
+	if step < 1 {
+		step = 1
+	}
+	var luma [][]float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		var row []float64
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, _ := img.At(x, y).RGBA()
+			row = append(row, (0.299*float64(r)+0.587*float64(g)+0.114*float64(b))/0xffff)
+		}
+		luma = append(luma, row)
+	}
+	return luma
+}
+
+// 隣り合う画素の差に対する2階差分の比
+// 自然な画像は滑らかに変化するが、画面の画素格子は1画素ごとに明暗が反転して比が2に近づく
+func moireScore(luma [][]float64) float64 {
+	var first, second float64
+	for _, row := range luma {
+		for x := 1; x < len(row)-1; x++ {
+			first += math.Abs(row[x+1] - row[x])
+			second += math.Abs(row[x-1] - 2*row[x] + row[x+1])
+		}
+	}
+	if first == 0 {
+		return 0
+	}
+	return clamp((second/first - 1.2) / 0.6)
+}
+
+// 白飛びした画素の割合（5%以上で最大）
+func glareScore(luma [][]float64) float64 {
+	var clipped, total float64
+	for _, row := range luma {
+		for _, v := range row {
+			if v >= 0.98 {
+				clipped++
+			}
+			total++
+		}
+	}
+	return clamp(clipped / total / 0.05)
+}
+
+// 明るさの幅（5-95パーセンタイル）の狭さ（幅0.5以上で0、0.1以下で最大）
+func rangeScore(luma [][]float64) float64 {
+	var values []float64
+	for _, row := range luma {
+		values = append(values, row...)
+	}
+	sort.Float64s(values)
+	spread := values[len(values)*95/100] - values[len(values)*5/100]
+	return clamp((0.5 - spread) / 0.4)
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,55 @@
+package spoof
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// 画素ごとの色を指定してPNGを生成する
+func encodePNG(t *testing.T, size int, pixel func(x, y int) uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetGray(x, y, color.Gray{Y: pixel(x, y)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestHeuristicDetector(t *testing.T) {
+	detector := NewHeuristicDetector()
+	tests := []struct {
+		name     string
+		pixel    func(x, y int) uint8
+		min, max float64
+	}{
+		// 明るさの幅が広く滑らかに変化する画像
+		{name: "自然な画像", pixel: func(x, y int) uint8 { return uint8(x * 250 / 127) }, min: 0, max: 10},
+		// 1画素ごとに明暗が反転する画素格子と白飛び
+		{name: "画面の再撮影", pixel: func(x, y int) uint8 { return uint8((x % 2) * 255) }, min: 60, max: 100},
+		// 明るさの幅が狭い
+		{name: "印刷物", pixel: func(x, y int) uint8 { return uint8(120 + (x+y)%10) }, min: 25, max: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, err := detector.Score(encodePNG(t, 128, tt.pixel))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if score < tt.min || score > tt.max {
+				t.Errorf("スコア: got %v, want %v-%v", score, tt.min, tt.max)
+			}
+		})
+	}
+	if _, err := detector.Score([]byte("not an image")); err == nil {
+		t.Error("画像でないデータでエラーにならなかった")
+	}
+}
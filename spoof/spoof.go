@@ -0,0 +1,30 @@
+package spoof
+
+import (
+	"fmt"
+)
+
+// なりすまし検知バックエンド名（config.iniの[face] spoof_detectorに指定する）
+const (
+	BackendNone      = "none"
+	BackendHeuristic = "heuristic"
+)
+
+// なりすまし検知エンジン
+// 撮影した写真が画面・印刷物を再撮影したものである可能性をスコア（0-100：大きいほど疑わしい）で返す
+// 外部のエンジンを利用する場合はこのインターフェースを実装する
+type Detector interface {
+	Score(image []byte) (float64, error)
+}
+
+// 設定値に応じたなりすまし検知エンジンを生成（noneの場合はnilを返し、検知しない）
+func New(backend string) (Detector, error) {
+	switch backend {
+	case "", BackendNone:
+		return nil, nil
+	case BackendHeuristic:
+		return NewHeuristicDetector(), nil
+	default:
+		return nil, fmt.Errorf("未対応のなりすまし検知バックエンドです: %s", backend)
+	}
+}
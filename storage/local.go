@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ローカルファイルシステムによる画像ストレージ（AWSを利用できないオンプレミス環境用）
+type LocalStore struct {
+	dir        string
+	baseURL    string
+	signingKey []byte
+}
+
+func NewLocalStore(dir string, baseURL string, signingKey string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, errors.New("画像の保存先ディレクトリが指定されていません")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{
+		dir:        dir,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		signingKey: []byte(signingKey),
+	}, nil
+}
+
+// 返すURLは署名がないため、そのままでは参照できない（参照させる場合はSignedURLを使う）
+func (s *LocalStore) Put(key string, data []byte, contentType string) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return s.baseURL + "/" + url.PathEscape(key), nil
+}
+
+func (s *LocalStore) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *LocalStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) SignedURL(key string, expires time.Duration) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expiresAt)
+	query.Set("signature", s.sign(key, expiresAt))
+	return s.baseURL + "/" + url.PathEscape(key) + "?" + query.Encode(), nil
+}
+
+// 署名付きURLの検証（期限切れ・署名不一致ならfalse）
+func (s *LocalStore) Verify(key string, expires string, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(key, expires)))
+}
+
+func (s *LocalStore) sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// キーから保存先のパスを決定（ディレクトリ外を指すキーは拒否する）
+func (s *LocalStore) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || key == "." || key == ".." {
+		return "", errors.New("画像のキーが不正です")
+	}
+	return filepath.Join(s.dir, key), nil
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// メモリ上の画像ストレージ（テスト用）
+type MemoryStore struct {
+	mu     sync.RWMutex
+	images map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{images: map[string][]byte{}}
+}
+
+func (s *MemoryStore) Put(key string, data []byte, contentType string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 呼び出し元でスライスを書き換えられても影響しないようコピーして保持する
+	s.images[key] = append([]byte(nil), data...)
+	return "memory://" + key, nil
+}
+
+func (s *MemoryStore) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.images[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.images, key)
+	return nil
+}
+
+func (s *MemoryStore) SignedURL(key string, expires time.Duration) (string, error) {
+	if _, err := s.Get(key); err != nil {
+		return "", err
+	}
+	return "memory://" + key + "?expires=" + strconv.FormatInt(time.Now().Add(expires).Unix(), 10), nil
+}
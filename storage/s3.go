@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"face-recognition/aws"
+	"time"
+)
+
+// AWS S3による画像ストレージ
+type S3Store struct {
+	client *aws.Client
+}
+
+func NewS3Store(client *aws.Client) *S3Store {
+	return &S3Store{client: client}
+}
+
+func (s *S3Store) Put(key string, data []byte, contentType string) (string, error) {
+	return s.client.PutObject(key, data, contentType)
+}
+
+func (s *S3Store) Get(key string) ([]byte, error) {
+	data, err := s.client.GetObject(key)
+	if err == aws.ErrNoSuchKey {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *S3Store) Delete(key string) error {
+	return s.client.DeleteObject(key)
+}
+
+func (s *S3Store) SignedURL(key string, expires time.Duration) (string, error) {
+	return s.client.PresignGetObject(key, expires)
+}
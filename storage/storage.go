@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"face-recognition/aws"
+	"fmt"
+	"time"
+)
+
+// 画像ストレージのバックエンド名（config.iniの[storage] backendに指定する）
+const (
+	BackendS3     = "s3"
+	BackendLocal  = "local"
+	BackendMemory = "memory"
+)
+
+// 指定したキーの画像が存在しない
+var ErrNotFound = errors.New("画像が存在しません")
+
+// 画像ストレージの生成オプション
+type Options struct {
+	Backend string
+	// AWS S3の接続に利用するクライアント
+	AWS *aws.Client
+	// ローカルファイルシステムの保存先ディレクトリ
+	LocalDir string
+	// ローカルファイルシステムに保存した画像を公開するURL
+	BaseURL string
+	// ローカルファイルシステムの署名付きURLに利用する鍵
+	SigningKey string
+}
+
+// 画像ストレージ
+// ハンドラはこのインターフェースにのみ依存し、実装はデプロイ環境ごとに切り替える
+type ImageStore interface {
+	// 画像を保存し、参照用のURLを返す
+	Put(key string, data []byte, contentType string) (url string, err error)
+	// 画像を取得する（存在しなければErrNotFound）
+	Get(key string) ([]byte, error)
+	// 画像を削除する
+	Delete(key string) error
+	// 期限付きで参照できる署名付きURLを返す
+	SignedURL(key string, expires time.Duration) (string, error)
+}
+
+// 設定値に応じた画像ストレージを生成
+func New(opts Options) (ImageStore, error) {
+	switch opts.Backend {
+	case "", BackendS3:
+		return NewS3Store(opts.AWS), nil
+	case BackendLocal:
+		return NewLocalStore(opts.LocalDir, opts.BaseURL, opts.SigningKey)
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("未対応の画像ストレージです: %s", opts.Backend)
+	}
+}
+
+// 拡張子からContent-Typeを決定
+func ContentType(extension string) (string, error) {
+	switch extension {
+	case "jpg", "jpeg":
+		return "image/jpeg", nil
+	case "png":
+		return "image/png", nil
+	default:
+		return "", errors.New("拡張子が無効です")
+	}
+}
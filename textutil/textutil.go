@@ -0,0 +1,17 @@
+package textutil
+
+import (
+	"unicode/utf8"
+)
+
+// 最大バイト数で切り詰める（マルチバイト文字の途中では切らない。0以下なら切り詰めない）
+func Truncate(s string, maxBytes int) string {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return s
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}